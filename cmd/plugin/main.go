@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Set by goreleaser.
@@ -29,7 +30,12 @@ func main() {
 apply - generates and applies templates to the target cluster but doesn't perform actions
 apply-with-actions - generates and applies templates and actions to the target cluster
 generate - generates templates and writes them to stdout instead of applying them
-generate-with-actions - generates templates and actions and writes them to stdout instead of applying them`)
+generate-with-actions - generates templates and actions and writes them to stdout instead of applying them
+history - lists the revisions in the prune store history
+rollback - applies the objects of the -revision and prunes objects that are not in that revision
+uninstall - deletes all objects recorded in the prune store and the store itself
+preflight - checks if the job can be applied to the target cluster (kinds, namespaces and permissions)
+lint - validates the generated objects against schemas without accessing the target cluster`)
 	var dryRun bool
 	flag.BoolVar(&dryRun, "dry-run", false,
 		`Dry-run prevents any change being made to the target cluster`)
@@ -37,6 +43,44 @@ generate-with-actions - generates templates and actions and writes them to stdou
 	flag.BoolVar(&noDelete, "no-delete", false,
 		`No-delete prevents prune from deleting objects in target cluster`)
 
+	var deleteTimeout time.Duration
+	flag.DurationVar(&deleteTimeout, "delete-timeout", 5*time.Minute,
+		`Max time to wait for deleted objects to disappear (uninstall, prune with wait)`)
+	var pruneBackupDir string
+	flag.StringVar(&pruneBackupDir, "prune-backup-dir", "",
+		`Directory to write objects to before prune deletes them (overrides job prune.backupDir)`)
+	var adopt bool
+	flag.BoolVar(&adopt, "adopt", false,
+		`Adopt allows apply to take ownership of objects that are owned by another job (store)`)
+	var preflight bool
+	flag.BoolVar(&preflight, "preflight", false,
+		`Preflight checks if the job can be applied to the target cluster before applying (also see -m preflight)`)
+	var force bool
+	flag.BoolVar(&force, "force", false,
+		`Force applies all steps, also the steps that are unchanged (see apply.incremental)`)
+	var schemaDir, kubernetesVersion, crdDir string
+	flag.StringVar(&schemaDir, "schema-dir", "",
+		`Directory with Kubernetes JSON schemas in kubeconform layout (see -m lint)`)
+	flag.StringVar(&kubernetesVersion, "kubernetes-version", "master",
+		`Kubernetes version of the schemas in -schema-dir like 1.20.0 (see -m lint)`)
+	flag.StringVar(&crdDir, "crd-dir", "",
+		`Directory with CustomResourceDefinition yaml files to validate custom resources with (see -m lint)`)
+	var deprecationsFile string
+	flag.StringVar(&deprecationsFile, "deprecations-file", "",
+		`Yaml file with deprecated API versions that extends the built-in table (see -m lint)`)
+	var policyDir string
+	flag.StringVar(&policyDir, "policy-dir", "",
+		`Directory with yaml files with policy rules that are checked for all objects (also see job policy)`)
+	var outputDir string
+	flag.StringVar(&outputDir, "output-dir", "",
+		`Directory to write generated objects to (a file per object and an index.yaml) instead of stdout (see -m generate)`)
+	var outputFormat string
+	flag.StringVar(&outputFormat, "output-format", execute.OutputFormatText,
+		`Format of the generated output; text, json (an array of instructions) or jsonl (an instruction per line) (see -m generate)`)
+	var revision int
+	flag.IntVar(&revision, "revision", 0,
+		`Revision to rollback to (see -m rollback)`)
+
 	var jobFile string
 	flag.StringVar(&jobFile, "job-file", "",
 		`Yaml file with steps to perform`)
@@ -80,7 +124,7 @@ generate-with-actions - generates templates and actions and writes them to stdou
 		os.Exit(0)
 	}
 
-	if msg := validate(jobFile, verbosity); len(msg) > 0 {
+	if msg := validate(mode.V, jobFile, revision, verbosity, outputDir, outputFormat); len(msg) > 0 {
 		_, _ = fmt.Fprintln(os.Stderr, strings.Join(msg, ", "))
 		flag.Usage()
 		os.Exit(1)
@@ -90,7 +134,7 @@ generate-with-actions - generates templates and actions and writes them to stdou
 	log := stdr.New(stdlog.New(os.Stderr, "I ", stdlog.Ltime))
 
 	var out io.Writer
-	if mode.V&tool.ModeGenerate != 0 {
+	if mode.V&(tool.ModeGenerate|tool.ModeHistory) != 0 {
 		//TODO move this to tool?
 		out = os.Stdout
 	}
@@ -104,10 +148,23 @@ generate-with-actions - generates templates and actions and writes them to stdou
 		JobFilepath:   jobFile,
 		ValueFilepath: setFile,
 		VaultPath:     masterVaultPath,
+		Revision:      revision,
+		Version:       version,
+		Preflight:     preflight,
+		PolicyDir:     policyDir,
 		Execute: &execute.Execute{
-			DryRun:   dryRun,
-			NoDelete: noDelete,
-			Environ:  environ,
+			DryRun:         dryRun,
+			NoDelete:       noDelete,
+			Adopt:          adopt,
+			Force:          force,
+			DeleteTimeout:  deleteTimeout,
+			PruneBackupDir: pruneBackupDir,
+			Environ:        environ,
+
+			SchemaDir:         schemaDir,
+			KubernetesVersion: kubernetesVersion,
+			CRDDir:            crdDir,
+			DeprecationsFile:  deprecationsFile,
 			Kubectl: execute.Kubectl{
 				KubeConfig:  kubeConfig,
 				KubeContext: kubeContext,
@@ -115,8 +172,10 @@ generate-with-actions - generates templates and actions and writes them to stdou
 				Environ:     environ,
 				Log:         log,
 			},
-			Out: out,
-			Log: log,
+			Out:          out,
+			OutputDir:    outputDir,
+			OutputFormat: outputFormat,
+			Log:          log,
 		},
 		Log: log,
 	}
@@ -128,13 +187,34 @@ generate-with-actions - generates templates and actions and writes them to stdou
 }
 
 // Validate checks flags and environment variables and returns a list error strings.
-func validate(jobFile string, verbosity int) []string {
+func validate(mode tool.Mode, jobFile string, revision int, verbosity int, outputDir, outputFormat string) []string {
 	var r []string
 
 	if jobFile == "" {
 		r = append(r, "-job-file should be defined")
 	}
 
+	if mode&tool.ModeRollback != 0 && revision <= 0 {
+		r = append(r, "-revision should be defined")
+	}
+
+	if outputDir != "" && mode&tool.ModeGenerate == 0 {
+		r = append(r, "-output-dir can only be used with -m generate or generate-with-actions")
+	}
+
+	switch outputFormat {
+	case execute.OutputFormatText:
+	case execute.OutputFormatJSON, execute.OutputFormatJSONL:
+		if mode&tool.ModeGenerate == 0 {
+			r = append(r, "-output-format can only be used with -m generate or generate-with-actions")
+		}
+		if outputDir != "" {
+			r = append(r, "-output-format can't be used with -output-dir")
+		}
+	default:
+		r = append(r, "-output-format should be one of text, json or jsonl")
+	}
+
 	if verbosity < 0 || verbosity > 5 {
 		r = append(r, "-verbosity should be in the range 0..5")
 	}
@@ -188,16 +268,50 @@ const help = `%[1]s reads a job file and performs the steps.
 
 %[1]s can operate in 'generate' or 'apply' mode.
 In 'generate' mode a 'kubectl apply -f -' consumable output is generated ('wait' and 'action' steps are skipped)
+With -output-dir the generated output is written to a directory tree instead; each step gets a NN-<template>
+directory with a <kind>[.<group>]-<namespace>-<name>.yaml file per object (without namespace for cluster scoped
+objects) and index.yaml lists the steps in order with their apply/wait args, actions and files. The directories listed
+in the index.yaml of a previous run are removed first so the tree can be committed to a GitOps repo and diffed per
+object.
+With -output-format json or jsonl the generated output is a JSON array or JSON Lines of instructions for other tools
+to consume. Each instruction has an id (step.document or step), type (tmplt, wait or action), template, kubectl args,
+portForward (actions) and the object (tmplt) or action document as JSON.
 In 'apply' mode steps are applied to the target cluster and (optionally) objects are pruned.
+In 'preflight' mode (or with -preflight before applying) all steps are rendered and the permissions they need are
+checked with SelfSubjectAccessReviews; get/create/patch for applied objects, get/delete for pruned objects, access to
+the prune store, get secrets for getSecret actions and pods/portforward for action port-forwards.
+Preflight also checks that each kind is served by the cluster (or created by a CRD earlier in the job), that each
+target namespace exists (or is created earlier in the job) and that namespaces are only set on namespaced kinds.
+Issues (with their ##step.document id) and missing permissions are listed in tables and nothing is applied.
+
+In 'lint' mode all steps are rendered and each object is validated against JSON schemas without accessing the target
+cluster. Kubernetes schemas are read from -schema-dir using the kubeconform layout;
+  <schema-dir>/<kubernetes-version>-standalone-strict/<kind>[-<group>]-<version>.json (or -standalone)
+  <schema-dir>/<group>/<kind>_<version>.json for custom resources
+Custom resources are also validated with the schemas of the CRDs in -crd-dir and of CRDs rendered earlier in the job.
+Unknown fields (like a 'contianers' typo) are reported for strict schemas and CRDs. Without -schema-dir only custom
+resources of known CRDs are validated.
+Lint also reports objects that use an apiVersion that is removed in -kubernetes-version (with the replacement
+apiVersion), deprecated apiVersions are logged as warning. The built-in deprecation table can be extended (or
+overridden) with -deprecations-file, for example;
+  - apiVersion: example.com/v1alpha1
+    kind: Example  # optional, all kinds when absent
+    deprecatedIn: "1.20"
+    removedIn: "1.22"
+    replacement: example.com/v1
+Errors are listed with their ##step.document id and the location in the object.
 
 
 JOB FILE
 A Job file specifies what %[1]s should do.
 
 Consider a job file containing;
+	apply:
+	  order: kind
 	prune:
 	  labels:
 		my.example.com/gitops: minikube-all
+	  order: kind
 	  store:
 		name: minikube-all
 		namespace: default
@@ -212,6 +326,64 @@ Consider a job file containing;
 	  first: hello
 	  second: world
 
+Apply order (optional) selects the order in which the objects of a tmplt step are applied; by default objects are
+applied in the order they are rendered, 'kind' applies Namespaces, CRDs, RBAC, ConfigMaps/Secrets, Services, workloads,
+custom resources and finally webhooks.
+Apply batch (optional) set to true applies the objects of a tmplt step with a single kubectl invocation instead of one
+invocation per object. Objects following a CRD are applied in a separate batch. When a batch fails its objects are
+applied one by one to report the failing object.
+Apply incremental (optional) set to true skips the 'kubectl apply' of tmplt steps that are unchanged since the previous
+run. A hash of the rendered objects and target cluster of each step is kept in the <store name>-steps object. Steps
+are applied when their hash differs or when one of their objects doesn't exist or is owned by another store. Use
+-force to apply all steps.
+Requires a prune store.
+Apply commonAnnotations (optional) are added to all objects. Apply runAnnotations (optional) is a list of run details
+to add as annotations to all objects; 'time' (deploy.mmlt.nl/time), 'jobFile' (deploy.mmlt.nl/job-file), 'gitCommit'
+(deploy.mmlt.nl/git-commit of the repo containing the job file) and 'version' (deploy.mmlt.nl/version).
+Apply annotationKinds (optional) limits common and run annotations to objects of the listed kinds.
+'time' is ignored by apply incremental; a skipped step keeps the time of the run that applied it.
+Apply checksums (optional) set to true adds a 'checksum/<name>' annotation with the hash of the data of a ConfigMap or
+Secret to the pod template of Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and CronJobs that reference it
+(via volumes, envFrom or env valueFrom). This rolls the workload when the ConfigMap or Secret changes. The ConfigMap
+or Secret must be rendered in the same or an earlier tmplt step of the job.
+Apply namespace (optional) is set on namespaced objects that don't have a namespace, cluster scoped objects are left
+alone. A tmplt step 'namespace:' overrides it for the objects of that step. Discovery (and CRDs in the job) tell which
+kinds are namespaced. Apply subjectNamespaces (optional) set to true also sets the namespace of ServiceAccount subjects
+without namespace; to the namespace of a RoleBinding or to apply/step namespace for ClusterRoleBindings.
+Apply images (optional) rewrites the container images of Pods and workloads (containers, initContainers and
+ephemeralContainers) and of the configured custom resource paths, for example;
+	apply:
+	  images:
+	    rewrite:
+	    - from: docker.io/*
+	      to: mirror.local/*
+	    lockFile: images.lock # optional, relative to the job file
+	    paths: # optional
+	    - kind: Example
+	      path: spec.containers[].image
+Rewrite rules match the fully qualified image (nginx:1.19 is docker.io/library/nginx:1.19) or its repository, the
+first matching rule is used. The lock file is a yaml map of images (before rewriting) to digests like
+'docker.io/library/nginx:1.19: sha256:0123...', matching images are pinned to that digest (image:tag@digest).
+Images are rewritten in all modes so generated output equals what is applied.
+
+Policy (optional) rules are checked for all objects before they are applied or generated. Rules are read from the
+yaml files in policy dir (relative to the job file), -policy-dir and policy rules, for example;
+	policy:
+	  rules:
+	  - name: no-latest-tag
+	    severity: deny # (default) fails the run, 'warn' logs the violation
+	    kinds: [Deployment, StatefulSet, DaemonSet] # optional, all kinds when absent
+	    expression: "object.spec.template.spec.containers.all(c, !c.image.endsWith(':latest'))"
+	    message: image tag latest is not allowed
+The expression is a CEL expression that evaluates to true when 'object' complies, an expression that can't be
+evaluated (for example because a field is absent, use has()) is a violation. Violations are reported with the
+##step.document id of the object, '-m lint' and preflight report the violations of all steps.
+Objects with annotation 'deploy.mmlt.nl/policy-exempt' (a comma separated list of rule names or "*") are exempt.
+PostRenderer (optional) is a local executable followed by arguments like 'postRenderer: ./bin/render --env test'.
+It reads the rendered multi-document yaml of each tmplt step from stdin and writes the transformed yaml to stdout.
+The post-rendered yaml is applied or generated, a non-zero exit fails the step. An executable path (like ./bin/render)
+is relative to the job file, a name without path is looked up in PATH. A tmplt step 'postRenderer:' overrides it.
+
 Job files can contain templated values. In the above example .Values.text="hello world" is being passed to the template.
 Caveats:
 - The job file is parsed before expansion therefore {{ }} need to be wrapped in double quotes to have (arguably) valid yaml.
@@ -220,9 +392,37 @@ Caveats:
 Prune (optional) makes %[1]s to 1) add labels to all objects and 2) delete cluster objects that are no longer in the
 list of deployed objects. The list of deployed objects is stored as a ConfigMap with store.namespace/name in the target cluster.
 Extra fields can be stored by putting them below 'x', in the example a 'time' field is added with the time of deployment.
+For large numbers of objects the store can be configured with;
+	kind: Secret - store the list in a Secret instead of a ConfigMap
+	compress: true - store the list gzip compressed and base64 encoded
+	shardSize: 102400 - max number of bytes per object, larger lists are spread over objects named <name>-1, <name>-2 etc.
+	history: 10 - keep the last 10 revisions (time, job file hash, x and deployed objects) in <name>-history
+	manifests: true - add the applied objects to each revision (the history is then kept in a Secret)
+Stores in the original format or the previous kind are read and converted on the next write.
+'-m history' lists the revisions, '-m rollback -revision N' applies the objects of revision N (requires manifests)
+and prunes the objects that are not in that revision.
+'-m uninstall' deletes all objects in the store (in the order of prune order 'kind'), waits -delete-timeout for them
+to disappear (objects blocked by finalizers are reported) and finally deletes the store. Objects that are protected
+from pruning are not deleted. -dry-run and -no-delete prevent objects and the store from being deleted.
+Prune order selects the order in which objects are deleted; by default objects are deleted in reverse order of
+creation, 'kind' deletes webhooks first, then Ingresses/Services, workloads, other namespaced objects, cluster-wide
+objects and CRDs last.
+Prune 'wait: true' waits -delete-timeout for each deleted object to disappear, objects blocked by finalizers are
+reported and the store is not updated (so deletion is retried on the next run). Prune 'removeFinalizers' lists the
+finalizers ("*" for all) that are removed from objects that are still present after -delete-timeout, only use this
+for objects of which the controller is known to be gone. Uninstall also removes these finalizers.
+Prune 'backupDir' (or -prune-backup-dir) is a directory to which objects are written before prune or uninstall
+deletes them. Each run writes to a timestamped sub-directory, server managed fields are removed so an accidental
+prune can be undone with 'kubectl apply -f <dir>'.
+Objects get a 'deploy.mmlt.nl/owner: store.namespace/name' annotation. Applying an object that is owned by another
+store fails unless -adopt is set. Prune doesn't delete objects that are owned by another store or that have a
+'deploy.mmlt.nl/prune: "false"' annotation.
 Note:
 - Each Job file must use an unique store.namespace/name (otherwise they prune each others objects)
-- Labeling causes fields in yaml output to be sorted, comments to be removed, single quotes become double quotes.
+- Labels and annotations are inserted in the rendered yaml; key order, comments and quoting are kept. Only flow style
+  metadata (like 'metadata: {name: x}') is re-encoded.
+- List documents (kind List or <Kind>List) are flattened; each item is labelled, applied and pruned as an object
+  with id step.document.item (like 01.02.03).
 
 
 STEPS
@@ -236,6 +436,24 @@ All steps except 'wait' accept 'value:' as extra arguments for template expansio
 
 TMPLT STEP
 A tmplt step expands the argument template file. 
+The optional 'namespace:' field sets the namespace of namespaced objects without namespace (see apply namespace).
+The optional 'patches:' field modifies the rendered objects before they are labelled, for example;
+	- tmplt: tpl/app.yaml
+	  patches:
+	  - target: # optional fields group, version, kind, name, namespace and labels select the objects to patch
+		kind: Deployment
+		name: app
+	    patch: # a strategic merge patch (a JSON merge patch for kinds like custom resources)
+		spec:
+		  replicas: 3
+	  - target:
+		labels:
+		  app: web
+	    jsonPatch: # a RFC 6902 JSON patch
+	    - {op: add, path: /metadata/annotations/x, value: "y"}
+A patch sets either 'patch:' or 'jsonPatch:', a patch that doesn't select any object of the step is an error.
+Built-in kinds at a version without strategic merge information must use 'jsonPatch:'. Patched objects are re-encoded.
+The optional 'postRenderer:' field sets the post-renderer of the step (see postRenderer).
 
 
 WAIT STEP
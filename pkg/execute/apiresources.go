@@ -2,89 +2,177 @@ package execute
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"github.com/mmlt/kubectl-tmplt/pkg/util/texttable"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/backoff"
 	"io/ioutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strings"
+	"time"
 )
 
 // APIResource helpers
 
-// FilterAPIResources removes resources that are not deployable.
-func filterAPIResources(list []metav1.APIResource) ([]metav1.APIResource, error) {
-	const remove = `NAME                              SHORTNAMES   APIGROUP                       NAMESPACED   KIND
-apiservices                                    apiregistration.k8s.io         false        APIService
-bindings                                                                      true         Binding
-certificatesigningrequests        csr          certificates.k8s.io            false        CertificateSigningRequest
-componentstatuses                 cs                                          false        ComponentStatus
-controllerrevisions                            apps                           true         ControllerRevision
-csinodes                                       storage.k8s.io                 false        CSINode
-endpoints                         ep                                          true         Endpoints
-events                            ev                                          true         Event
-limitranges                       limits                                      true         LimitRange
-localsubjectaccessreviews                      authorization.k8s.io           true         LocalSubjectAccessReview
-nodes                             no                                          false        Node
-podtemplates                                                                  true         PodTemplate
-runtimeclasses                                 node.k8s.io                    false        RuntimeClass
-selfsubjectaccessreviews                       authorization.k8s.io           false        SelfSubjectAccessReview
-selfsubjectrulesreviews                        authorization.k8s.io           false        SelfSubjectRulesReview
-subjectaccessreviews                           authorization.k8s.io           false        SubjectAccessReview
-tokenreviews                                   authentication.k8s.io          false        TokenReview
-volumeattachments                              storage.k8s.io                 false        VolumeAttachment
-`
-	rlist, err := textToAPIResources(remove)
+// Discovery is the result of discovering the API resources served by the target cluster.
+type discovery struct {
+	// Resources with Group, Version, Kind, Name and Namespaced set.
+	resources []metav1.APIResource
+	// Unavailable are the group/versions that could not be read, for example because an aggregated API server is down.
+	unavailable []metav1.GroupVersion
+}
+
+// GetK8sAPIResources returns all APIResources served by the target cluster.
+// The result is cached for the lifetime of the receiver.
+func (x *Execute) getK8sAPIResources() ([]metav1.APIResource, error) {
+	if x.discovered != nil {
+		return x.discovered.resources, nil
+	}
+
+	d, err := discover(x.Kubectl)
 	if err != nil {
 		return nil, err
 	}
-	var result []metav1.APIResource
-	for _, ar := range list {
-		ok := true
-		for _, rar := range rlist {
-			if ar.Name == rar.Name {
-				ok = false
-				break
-			}
+	for _, gv := range d.unavailable {
+		x.log("discovery WARNING; api unavailable", 0, 0, "", gv.String())
+	}
+	x.discovered = d
+
+	return d.resources, nil
+}
+
+// IsUnavailable returns true when group could not be (completely) discovered.
+func (x *Execute) isUnavailable(group string) bool {
+	if x.discovered == nil {
+		return false
+	}
+	for _, gv := range x.discovered.unavailable {
+		if gv.Group == group {
+			return true
 		}
-		if ok {
-			result = append(result, ar)
+	}
+	return false
+}
+
+// Discover reads the API resources from the target cluster via the /api and /apis discovery endpoints.
+// Group/versions that can't be read (after some retries) are reported as unavailable instead of failing discovery.
+func discover(kubectl Kubectler) (*discovery, error) {
+	r := &discovery{}
+
+	// legacy (core) group
+	stdout, _, err := kubectl.Run(nil, "", "get", "--raw", "/api")
+	if err != nil {
+		return nil, fmt.Errorf("discovery /api: %w", err)
+	}
+	vs := &metav1.APIVersions{}
+	err = json.Unmarshal([]byte(stdout), vs)
+	if err != nil {
+		return nil, fmt.Errorf("discovery /api: %w", err)
+	}
+	var gvs []metav1.GroupVersion
+	for _, v := range vs.Versions {
+		gvs = append(gvs, metav1.GroupVersion{Version: v})
+	}
+
+	// named groups
+	stdout, _, err = kubectl.Run(nil, "", "get", "--raw", "/apis")
+	if err != nil {
+		return nil, fmt.Errorf("discovery /apis: %w", err)
+	}
+	gl := &metav1.APIGroupList{}
+	err = json.Unmarshal([]byte(stdout), gl)
+	if err != nil {
+		return nil, fmt.Errorf("discovery /apis: %w", err)
+	}
+	for _, g := range gl.Groups {
+		for _, v := range g.Versions {
+			gvs = append(gvs, metav1.GroupVersion{Group: g.Name, Version: v.Version})
 		}
 	}
-	return result, nil
+
+	// resources per group/version
+	for _, gv := range gvs {
+		list, err := discoverGroupVersion(kubectl, gv)
+		if err != nil {
+			r.unavailable = append(r.unavailable, gv)
+			continue
+		}
+		r.resources = append(r.resources, list...)
+	}
+
+	return r, nil
 }
 
-// TextToAPIResources turns text into APIResource objects.
-func textToAPIResources(txt string) ([]metav1.APIResource, error) {
-	t := texttable.Read(strings.NewReader(txt), 3)
-	iter := t.RowIter()
-	var result []metav1.APIResource
-	for iter.Next() {
-		var ok bool
-		ar := metav1.APIResource{}
-		//TODO handle ok from GetColByName
-		s, _ := iter.GetColByName("NAME")
-		ar.Name = s
-		s, _ = iter.GetColByName("NAMESPACED")
-		ar.Namespaced = (s == "true")
-		s, _ = iter.GetColByName("KIND")
-		ar.Kind = s
-
-		// APIVERSION contains "v1" or "apps/v1", APIGROUP contains "apps"
-		if s, ok = iter.GetColByName("APIVERSION"); ok {
-			gv := strings.Split(s, "/")
-			if len(gv) == 1 {
-				ar.Version = s
-			} else {
-				ar.Group = gv[0]
-				ar.Version = gv[1]
-			}
-		} else if s, ok = iter.GetColByName("APIGROUP"); ok {
-			ar.Group = s
+// DiscoverGroupVersion returns the resources (excluding sub-resources) of a single group/version.
+// Reading is retried a few times to ride out temporarily unavailable aggregated API servers.
+func discoverGroupVersion(kubectl Kubectler, gv metav1.GroupVersion) ([]metav1.APIResource, error) {
+	path := "/apis/" + gv.String()
+	if gv.Group == "" {
+		path = "/api/" + gv.Version
+	}
+
+	var stdout string
+	var err error
+	for exp := backoff.NewExponential(2 * time.Second); exp.Retries() < 3; exp.Sleep() {
+		stdout, _, err = kubectl.Run(nil, "", "get", "--raw", path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("discovery %s: %w", path, err)
+	}
+
+	rl := &metav1.APIResourceList{}
+	err = json.Unmarshal([]byte(stdout), rl)
+	if err != nil {
+		return nil, fmt.Errorf("discovery %s: %w", path, err)
+	}
+
+	var r []metav1.APIResource
+	for _, ar := range rl.APIResources {
+		if strings.Contains(ar.Name, "/") {
+			// sub-resource like pods/log
+			continue
 		}
+		ar.Group = gv.Group
+		ar.Version = gv.Version
+		r = append(r, ar)
+	}
+
+	return r, nil
+}
+
+// FilterAPIResources removes resources that are not deployable.
+func filterAPIResources(list []metav1.APIResource) []metav1.APIResource {
+	remove := map[string]bool{
+		"apiservices":                true,
+		"bindings":                   true,
+		"certificatesigningrequests": true,
+		"componentstatuses":          true,
+		"controllerrevisions":        true,
+		"csinodes":                   true,
+		"endpoints":                  true,
+		"events":                     true,
+		"limitranges":                true,
+		"localsubjectaccessreviews":  true,
+		"nodes":                      true,
+		"podtemplates":               true,
+		"runtimeclasses":             true,
+		"selfsubjectaccessreviews":   true,
+		"selfsubjectrulesreviews":    true,
+		"subjectaccessreviews":       true,
+		"tokenreviews":               true,
+		"volumeattachments":          true,
+	}
 
+	var result []metav1.APIResource
+	for _, ar := range list {
+		if remove[ar.Name] {
+			continue
+		}
 		result = append(result, ar)
 	}
-	return result, nil
+	return result
 }
 
 // MustWriteAPIResourcesCSV writes a CSV file with list for debugging purposes.
@@ -108,13 +196,27 @@ func asAPIResourceCSV(list []metav1.APIResource) bytes.Buffer {
 }
 
 // Resource returns the name of the resource like; pod, configmap, xyz.constraints.gatekeeper.sh
+// The version of gvk is ignored because the resource name is the same for all versions and objects from the store
+// might have been recorded at a version that is no longer served.
 func resource(gvk metav1.GroupVersionKind, resources []metav1.APIResource) (string, error) {
+	gk := gvk
+	gk.Version = ""
+	r, ok := apiResource(gk, resources)
+	if !ok {
+		return "", fmt.Errorf("no api-resource for %s", gvk.String())
+	}
+	return fullAPIResourceName(r), nil
+}
+
+// APIResource returns the API resource of gvk.
+// The version is only compared when both gvk and the resource have one.
+func apiResource(gvk metav1.GroupVersionKind, resources []metav1.APIResource) (metav1.APIResource, bool) {
 	for _, r := range resources {
-		if r.Kind == gvk.Kind && r.Group == gvk.Group {
-			return fullAPIResourceName(r), nil
+		if r.Kind == gvk.Kind && r.Group == gvk.Group && (gvk.Version == "" || r.Version == "" || r.Version == gvk.Version) {
+			return r, true
 		}
 	}
-	return "", fmt.Errorf("no api-resource for %s", gvk.String())
+	return metav1.APIResource{}, false
 }
 
 // FullAPIResourceName returns name.group or name when group is empty.
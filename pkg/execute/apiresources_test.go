@@ -1,58 +1,115 @@
 package execute
 
 import (
+	"context"
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/backoff"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
 	"testing"
 )
 
-func Test_textToAPIResources(t *testing.T) {
+func Test_discover(t *testing.T) {
+	backoff.FF = true
+
 	tests := []struct {
-		it   string
-		arg  string
-		want []metav1.APIResource
+		it              string
+		fake            fakeKubectlArgs
+		want            []metav1.APIResource
+		wantUnavailable []metav1.GroupVersion
 	}{
 		{
-			it: "should read the output of v1.18 kubectl api-resources",
-			arg: `NAME                              SHORTNAMES           APIGROUP                       NAMESPACED   KIND
-bindings                                                                              true         Binding
-componentstatuses                 cs                                                  false        ComponentStatus
-pods                              po                                                  true         Pod
-deployments                       deploy               apps                           true         Deployment
-customresourcedefinitions         crd,crds             apiextensions.k8s.io           false        CustomResourceDefinition
-`,
+			it: "should_read_core_and_named_groups_and_skip_subresources",
+			fake: fakeKubectlArgs{
+				"get --raw /api":  `{"kind":"APIVersions","versions":["v1"]}`,
+				"get --raw /apis": `{"kind":"APIGroupList","groups":[{"name":"apps","versions":[{"groupVersion":"apps/v1","version":"v1"}]}]}`,
+				"get --raw /api/v1": `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+{"name":"pods","singularName":"","namespaced":true,"kind":"Pod","verbs":["get"]},
+{"name":"pods/log","singularName":"","namespaced":true,"kind":"Pod","verbs":["get"]},
+{"name":"namespaces","singularName":"","namespaced":false,"kind":"Namespace","verbs":["get"]}]}`,
+				"get --raw /apis/apps/v1": `{"kind":"APIResourceList","groupVersion":"apps/v1","resources":[
+{"name":"deployments","singularName":"","namespaced":true,"kind":"Deployment","verbs":["get"]}]}`,
+			},
 			want: []metav1.APIResource{
-				{Name: "bindings", Namespaced: true, Group: "", Version: "", Kind: "Binding"},
-				{Name: "componentstatuses", Namespaced: false, Group: "", Version: "", Kind: "ComponentStatus"},
-				{Name: "pods", Namespaced: true, Group: "", Version: "", Kind: "Pod"},
-				{Name: "deployments", Namespaced: true, Group: "apps", Version: "", Kind: "Deployment"},
-				{Name: "customresourcedefinitions", Namespaced: false, Group: "apiextensions.k8s.io", Version: "", Kind: "CustomResourceDefinition"},
+				{Name: "pods", Namespaced: true, Group: "", Version: "v1", Kind: "Pod", Verbs: metav1.Verbs{"get"}},
+				{Name: "namespaces", Namespaced: false, Group: "", Version: "v1", Kind: "Namespace", Verbs: metav1.Verbs{"get"}},
+				{Name: "deployments", Namespaced: true, Group: "apps", Version: "v1", Kind: "Deployment", Verbs: metav1.Verbs{"get"}},
 			},
 		},
 		{
-			it: "should read the output of v1.20 kubectl api-resources",
-			arg: `NAME                                      SHORTNAMES      APIVERSION                             NAMESPACED   KIND
-bindings                                                  v1                                     true         Binding
-componentstatuses                         cs              v1                                     false        ComponentStatus
-pods                                      po              v1                                     true         Pod
-deployments                               deploy          apps/v1                                true         Deployment
-adcsrequests                                              adcs.certmanager.csf.nokia.com/v1      true         AdcsRequest
-`,
+			it: "should_report_unavailable_aggregated_api",
+			fake: fakeKubectlArgs{
+				"get --raw /api":  `{"kind":"APIVersions","versions":["v1"]}`,
+				"get --raw /apis": `{"kind":"APIGroupList","groups":[{"name":"metrics.k8s.io","versions":[{"groupVersion":"metrics.k8s.io/v1beta1","version":"v1beta1"}]}]}`,
+				"get --raw /api/v1": `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+{"name":"pods","singularName":"","namespaced":true,"kind":"Pod","verbs":["get"]}]}`,
+			},
 			want: []metav1.APIResource{
-				{Name: "bindings", Namespaced: true, Group: "", Version: "v1", Kind: "Binding"},
-				{Name: "componentstatuses", Namespaced: false, Group: "", Version: "v1", Kind: "ComponentStatus"},
-				{Name: "pods", Namespaced: true, Group: "", Version: "v1", Kind: "Pod"},
-				{Name: "deployments", Namespaced: true, Group: "apps", Version: "v1", Kind: "Deployment"},
-				{Name: "adcsrequests", Namespaced: true, Group: "adcs.certmanager.csf.nokia.com", Version: "v1", Kind: "AdcsRequest"},
+				{Name: "pods", Namespaced: true, Group: "", Version: "v1", Kind: "Pod", Verbs: metav1.Verbs{"get"}},
+			},
+			wantUnavailable: []metav1.GroupVersion{
+				{Group: "metrics.k8s.io", Version: "v1beta1"},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.it, func(t *testing.T) {
-			got, err := textToAPIResources(tt.arg)
+			got, err := discover(tt.fake)
 			if assert.NoError(t, err) {
-				assert.Equal(t, tt.want, got)
+				assert.Equal(t, tt.want, got.resources)
+				assert.Equal(t, tt.wantUnavailable, got.unavailable)
 			}
 		})
 	}
 }
+
+func Test_apiResource(t *testing.T) {
+	resources := []metav1.APIResource{
+		{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler", Name: "horizontalpodautoscalers"},
+		{Group: "example.com", Kind: "Example", Name: "examples"},
+	}
+	tests := []struct {
+		it     string
+		gvk    metav1.GroupVersionKind
+		wantOK bool
+	}{
+		{
+			it:     "should_find_served_version",
+			gvk:    metav1.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"},
+			wantOK: true,
+		},
+		{
+			it:  "should_not_find_removed_version",
+			gvk: metav1.GroupVersionKind{Group: "autoscaling", Version: "v2beta1", Kind: "HorizontalPodAutoscaler"},
+		},
+		{
+			it:     "should_find_any_version_when_gvk_has_no_version",
+			gvk:    metav1.GroupVersionKind{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"},
+			wantOK: true,
+		},
+		{
+			it:     "should_find_any_version_when_resource_has_no_version",
+			gvk:    metav1.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Example"},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			_, ok := apiResource(tt.gvk, resources)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
+
+// FakeKubectlArgs returns the stdout that matches the space separated args or a ServiceUnavailable error.
+type fakeKubectlArgs map[string]string
+
+func (k fakeKubectlArgs) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	a := strings.Join(args, " ")
+	s, ok := k[a]
+	if !ok {
+		return "", "", fmt.Errorf("kubectl %s: Error from server (ServiceUnavailable)", a)
+	}
+	return s, "", nil
+}
@@ -0,0 +1,78 @@
+package execute
+
+import (
+	"fmt"
+	yaml2 "gopkg.in/yaml.v2"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupDir returns the directory to write backups of deleted objects to or "" when backups are disabled.
+// Each invocation returns a new timestamped sub-directory of Execute.PruneBackupDir or opt.BackupDir.
+func (x *Execute) backupDir(opt PruneOpt) string {
+	d := x.PruneBackupDir
+	if d == "" {
+		d = opt.BackupDir
+	}
+	if d == "" {
+		return ""
+	}
+	return filepath.Join(d, time.Now().UTC().Format("20060102-150405"))
+}
+
+// Backup writes obj without server managed fields as a 'kubectl apply -f' consumable yaml file to dir.
+func (x *Execute) backup(dir string, obj *unstructured.Unstructured) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml2.Marshal(stripServerFields(obj).Object)
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(dir, objectFilename(obj.GroupVersionKind().Group, obj.GetKind(), obj.GetNamespace(), obj.GetName()))
+	err = ioutil.WriteFile(p, b, 0600)
+	if err != nil {
+		return err
+	}
+
+	x.log("backup", 0, 0, "", p)
+
+	return nil
+}
+
+// StripServerFields returns a copy of obj without the fields that are set by the API server.
+func stripServerFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	o := obj.DeepCopy()
+	for _, f := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+		"deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences"} {
+		unstructured.RemoveNestedField(o.Object, "metadata", f)
+	}
+	unstructured.RemoveNestedField(o.Object, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	if len(o.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(o.Object, "metadata", "annotations")
+	}
+	unstructured.RemoveNestedField(o.Object, "status")
+	return o
+}
+
+// ObjectFilename returns a filename like kind-namespace-name.yaml or kind.group-namespace-name.yaml for kinds of a
+// named API group (namespace is omitted when empty).
+func objectFilename(group, kind, namespace, name string) string {
+	k := strings.ToLower(kind)
+	if group != "" {
+		k += "." + group
+	}
+	parts := []string{k}
+	if namespace != "" {
+		parts = append(parts, namespace)
+	}
+	parts = append(parts, name)
+	return fmt.Sprintf("%s.yaml", strings.Join(parts, "-"))
+}
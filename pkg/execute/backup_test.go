@@ -0,0 +1,56 @@
+package execute
+
+import (
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecute_backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	live := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns",
+"uid":"1234","resourceVersion":"42","creationTimestamp":"2020-05-18T17:11:11Z",
+"managedFields":[{"manager":"kubectl"}],
+"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}","keep":"me"},
+"labels":{"app":"x"}},"data":{"k":"v"}}`
+	obj, err := decodeLiveObject(live)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	x := &Execute{Log: logrtesting.TestLogger{T: t}}
+	err = x.backup(dir, obj)
+	if assert.NoError(t, err) {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "configmap-ns-cm.yaml"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, `apiVersion: v1
+data:
+  k: v
+kind: ConfigMap
+metadata:
+  annotations:
+    keep: me
+  labels:
+    app: x
+  name: cm
+  namespace: ns
+`, string(b))
+		}
+	}
+}
+
+func Test_objectFilename(t *testing.T) {
+	assert.Equal(t, "configmap-ns-cm.yaml", objectFilename("", "ConfigMap", "ns", "cm"))
+	assert.Equal(t, "namespace-ns.yaml", objectFilename("", "Namespace", "", "ns"))
+	assert.NotEqual(t, objectFilename("example.com", "Certificate", "ns", "c"), objectFilename("cert-manager.io", "Certificate", "ns", "c"),
+		"same kind and name in different groups")
+	assert.Equal(t, "certificate.cert-manager.io-ns-c.yaml", objectFilename("cert-manager.io", "Certificate", "ns", "c"))
+}
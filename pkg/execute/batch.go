@@ -0,0 +1,160 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+)
+
+// ApplyBatches applies objects with a kubectl invocation per batch, see batches.
+// The kubectl output lines are logged with the id of the object they refer to.
+// When a batch fails, its objects are applied one by one to log the results and report the object that fails.
+func (x *Execute) applyBatches(name string, opt ApplyOpt, objects []object) error {
+	for _, batch := range batches(objects) {
+		if opt.Owner != "" && !x.Adopt {
+			err := x.checkOwners(name, batch, opt.Owner)
+			if err != nil {
+				return err
+			}
+		}
+
+		docs := make([][]byte, 0, len(batch))
+		for _, o := range batch {
+			docs = append(docs, o.doc)
+		}
+
+		stdout, _, err := x.Kubectl.Run(nil, string(joinDocs(docs)), x.applyArgs()...)
+		if err != nil {
+			x.log("apply", batch[0].id, 0, name, fmt.Sprintf("batch of %d objects failed, apply one by one", len(batch)))
+			for _, o := range batch {
+				err := x.applyObject(name, o)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		x.manifests = append(x.manifests, docs...)
+
+		lines := outputLines(stdout)
+		if len(lines) != len(batch) {
+			// can't relate lines to objects.
+			x.log("apply", batch[0].id, 0, name, stdout)
+			continue
+		}
+		for i, o := range batch {
+			x.log("apply", o.id, o.sub, name, lines[i])
+		}
+	}
+
+	return nil
+}
+
+// Batches splits objects in groups that can be applied with a single kubectl invocation.
+// Objects following a CustomResourceDefinition start a new batch because kubectl resolves the kinds of all objects
+// before applying the first one.
+func batches(objects []object) [][]object {
+	var r [][]object
+	var batch []object
+	for i, o := range objects {
+		if i > 0 && objects[i-1].knsn.GVK.Kind == "CustomResourceDefinition" && o.knsn.GVK.Kind != "CustomResourceDefinition" {
+			r = append(r, batch)
+			batch = nil
+		}
+		batch = append(batch, o)
+	}
+	if len(batch) > 0 {
+		r = append(r, batch)
+	}
+	return r
+}
+
+// CheckOwners returns an error when the live object of one of objects is owned by another store than owner.
+// All objects are read with a single kubectl invocation unless one of them is of a kind that isn't served.
+func (x *Execute) checkOwners(name string, objects []object, owner string) error {
+	docs := make([][]byte, 0, len(objects))
+	for _, o := range objects {
+		docs = append(docs, o.doc)
+	}
+
+	args := []string{"get", "-f", "-", "--ignore-not-found", "-o", "json"}
+	stdout, _, err := x.Kubectl.Run(nil, string(joinDocs(docs)), args...)
+	if err != nil {
+		if !isUnknownKind(err) {
+			return fmt.Errorf("tpl %s: get owner: %w", name, err)
+		}
+		// check objects one by one to skip the kind that isn't served.
+		for _, o := range objects {
+			err := x.checkOwner(o.doc, owner)
+			if err != nil {
+				return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
+		}
+		return nil
+	}
+
+	live, err := decodeLiveObjects(stdout)
+	if err != nil {
+		return fmt.Errorf("tpl %s: get owner: %w", name, err)
+	}
+
+	for _, l := range live {
+		o := l.GetAnnotations()[OwnerAnnotation]
+		if o == "" || o == owner {
+			continue
+		}
+		id := "??.??"
+		k := NewKindNamespaceName(l)
+		for _, obj := range objects {
+			if sameObject(obj.knsn, k) {
+				id = obj.ID()
+				break
+			}
+		}
+		return fmt.Errorf("##%s tpl %s: %s/%s is owned by store %s (use --adopt to take ownership)", id, name, k.GVK.Kind, k.Name, o)
+	}
+
+	return nil
+}
+
+// DecodeLiveObjects decodes the kubectl get -o json output of zero or more objects.
+func decodeLiveObjects(s string) ([]*unstructured.Unstructured, error) {
+	obj, err := decodeLiveObject(s)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	if !obj.IsList() {
+		return []*unstructured.Unstructured{obj}, nil
+	}
+
+	list := &unstructured.UnstructuredList{}
+	err = json.Unmarshal([]byte(s), list)
+	if err != nil {
+		return nil, err
+	}
+	var r []*unstructured.Unstructured
+	for i := range list.Items {
+		r = append(r, &list.Items[i])
+	}
+	return r, nil
+}
+
+// SameObject returns true when a and b refer to the same object.
+// Version is ignored and an empty namespace in a (rendered object) matches any namespace in b (live object).
+func sameObject(a, b KindNamespaceName) bool {
+	return a.GVK.Group == b.GVK.Group && a.GVK.Kind == b.GVK.Kind && a.Name == b.Name &&
+		(a.Namespace == "" || a.Namespace == b.Namespace)
+}
+
+// OutputLines returns the non-empty lines of s.
+func outputLines(s string) []string {
+	var r []string
+	for _, l := range strings.Split(s, "\n") {
+		if strings.TrimSpace(l) != "" {
+			r = append(r, l)
+		}
+	}
+	return r
+}
@@ -0,0 +1,143 @@
+package execute
+
+import (
+	"context"
+	"fmt"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestExecute_Apply_batch(t *testing.T) {
+	tests := []struct {
+		it        string
+		opt       ApplyOpt
+		doc       string
+		wantCalls int
+		wantErr   string
+	}{
+		{
+			it: "should_apply_all_objects_in_one_call",
+			doc: `kind: ConfigMap
+metadata:
+  name: a
+---
+kind: ConfigMap
+metadata:
+  name: b
+`,
+			wantCalls: 1,
+		},
+		{
+			it:  "should_apply_objects_after_crd_in_separate_call",
+			opt: ApplyOpt{Order: OrderKind},
+			doc: `kind: CustomResourceDefinition
+metadata:
+  name: crd
+---
+kind: Custom
+metadata:
+  name: b
+`,
+			wantCalls: 2,
+		},
+		{
+			it: "should_apply_objects_after_crd_in_separate_call_when_not_ordered",
+			doc: `kind: CustomResourceDefinition
+metadata:
+  name: crd
+---
+kind: Custom
+metadata:
+  name: b
+`,
+			wantCalls: 2,
+		},
+		{
+			it: "should_report_failing_object",
+			doc: `kind: ConfigMap
+metadata:
+  name: a
+---
+kind: ConfigMap
+metadata:
+  name: bad
+---
+kind: ConfigMap
+metadata:
+  name: c
+`,
+			wantCalls: 3,
+			wantErr:   "##01.02 tpl tpl: invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			k := &fakeApplier{}
+			x := &Execute{Kubectl: k, Log: logrtesting.TestLogger{T: t}}
+			opt := tt.opt
+			opt.Batch = true
+			_, err := x.Apply(1, "tpl", opt, []byte(tt.doc))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCalls, k.calls)
+		})
+	}
+}
+
+// FakeApplier fakes kubectl apply, it fails on stdin containing an object named 'bad'.
+type fakeApplier struct {
+	calls int
+}
+
+func (k *fakeApplier) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	k.calls++
+	if strings.Contains(stdin, "name: bad") {
+		return "", "", fmt.Errorf("invalid")
+	}
+	var out []string
+	for _, l := range strings.Split(stdin, "\n") {
+		if strings.HasPrefix(l, "  name: ") {
+			out = append(out, "object/"+strings.TrimPrefix(l, "  name: ")+" created")
+		}
+	}
+	return strings.Join(out, "\n"), "", nil
+}
+
+func Test_decodeLiveObjects(t *testing.T) {
+	tests := []struct {
+		it   string
+		in   string
+		want []string
+	}{
+		{
+			it: "should_decode_nothing",
+		},
+		{
+			it:   "should_decode_single_object",
+			in:   `{"kind":"ConfigMap","metadata":{"name":"a"}}`,
+			want: []string{"a"},
+		},
+		{
+			it:   "should_decode_list",
+			in:   `{"apiVersion":"v1","kind":"List","items":[{"kind":"ConfigMap","metadata":{"name":"a"}},{"kind":"Secret","metadata":{"name":"b"}}]}`,
+			want: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := decodeLiveObjects(tt.in)
+			if assert.NoError(t, err) {
+				var names []string
+				for _, o := range got {
+					names = append(names, o.GetName())
+				}
+				assert.Equal(t, tt.want, names)
+			}
+		})
+	}
+}
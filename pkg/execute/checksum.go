@@ -0,0 +1,177 @@
+package execute
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ChecksumAnnotationPrefix is the prefix of the pod template annotations with the hash of a referenced ConfigMap or
+// Secret, the annotation key is checksum/<name>.
+const ChecksumAnnotationPrefix = "checksum/"
+
+// PodTemplatePaths are the paths of the pod template in workload kinds.
+var podTemplatePaths = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// AddChecksums records the hashes of the ConfigMaps and Secrets in objects and adds checksum annotations to the pod
+// templates of workloads that reference ConfigMaps or Secrets that are rendered in this or an earlier step.
+func (x *Execute) addChecksums(objects []object) error {
+	if x.configHashes == nil {
+		x.configHashes = map[string]string{}
+	}
+
+	decoded := make([]*unstructured.Unstructured, len(objects))
+	for i, o := range objects {
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			return fmt.Errorf("##%s: %w", o.ID(), err)
+		}
+		decoded[i] = obj
+
+		if obj.GroupVersionKind().Group != "" {
+			continue
+		}
+		switch k := obj.GetKind(); k {
+		case "ConfigMap", "Secret":
+			h, err := configHash(obj)
+			if err != nil {
+				return fmt.Errorf("##%s: %w", o.ID(), err)
+			}
+			x.configHashes[configKey(k, obj.GetNamespace(), obj.GetName())] = h
+		}
+	}
+
+	for i, o := range objects {
+		obj := decoded[i]
+		path, ok := podTemplatePaths[obj.GetKind()]
+		if !ok {
+			continue
+		}
+		spec, ok, _ := unstructured.NestedMap(obj.Object, append(path, "spec")...)
+		if !ok {
+			continue
+		}
+
+		// hashes per name and kind of the referenced objects.
+		hashes := map[string]map[string]string{}
+		for _, r := range podSpecReferences(spec) {
+			h, ok := x.configHashes[configKey(r.kind, obj.GetNamespace(), r.name)]
+			if !ok {
+				continue
+			}
+			if hashes[r.name] == nil {
+				hashes[r.name] = map[string]string{}
+			}
+			hashes[r.name][r.kind] = h
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+
+		annotations := make(map[string]string, len(hashes))
+		for n, hs := range hashes {
+			// a ConfigMap and a Secret can have the same name.
+			h := hs["ConfigMap"] + hs["Secret"]
+			if len(hs) > 1 {
+				h = fmt.Sprintf("%x", sha256.Sum256([]byte(h)))
+			}
+			annotations[ChecksumAnnotationPrefix+n] = h
+		}
+
+		d, err := yamlx.AddMetadataAt(o.doc, path, nil, annotations)
+		if err != nil {
+			return fmt.Errorf("##%s: %w", o.ID(), err)
+		}
+		objects[i].doc = d
+	}
+
+	return nil
+}
+
+// ConfigKey returns the key of a ConfigMap or Secret in the config hashes.
+func configKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// ConfigHash returns the hash of the content of a ConfigMap or Secret.
+func configHash(obj *unstructured.Unstructured) (string, error) {
+	content := map[string]interface{}{}
+	for _, f := range []string{"data", "binaryData", "stringData", "type"} {
+		if v, ok := obj.Object[f]; ok {
+			content[f] = v
+		}
+	}
+	// json sorts map keys.
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// Reference is a reference from a pod spec to a ConfigMap or Secret.
+type reference struct {
+	kind, name string
+}
+
+// PodSpecReferences returns the ConfigMaps and Secrets that are referenced by volumes, envFrom and env valueFrom.
+func podSpecReferences(spec map[string]interface{}) []reference {
+	var r []reference
+	add := func(kind string, m map[string]interface{}, fields ...string) {
+		if n, ok, _ := unstructured.NestedString(m, fields...); ok && n != "" {
+			r = append(r, reference{kind: kind, name: n})
+		}
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for _, v := range volumes {
+		vol, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		add("ConfigMap", vol, "configMap", "name")
+		add("Secret", vol, "secret", "secretName")
+		sources, _, _ := unstructured.NestedSlice(vol, "projected", "sources")
+		for _, s := range sources {
+			if src, ok := s.(map[string]interface{}); ok {
+				add("ConfigMap", src, "configMap", "name")
+				add("Secret", src, "secret", "name")
+			}
+		}
+	}
+
+	for _, f := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, f)
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			envFrom, _, _ := unstructured.NestedSlice(container, "envFrom")
+			for _, e := range envFrom {
+				if ef, ok := e.(map[string]interface{}); ok {
+					add("ConfigMap", ef, "configMapRef", "name")
+					add("Secret", ef, "secretRef", "name")
+				}
+			}
+			env, _, _ := unstructured.NestedSlice(container, "env")
+			for _, e := range env {
+				if ev, ok := e.(map[string]interface{}); ok {
+					add("ConfigMap", ev, "valueFrom", "configMapKeyRef", "name")
+					add("Secret", ev, "valueFrom", "secretKeyRef", "name")
+				}
+			}
+		}
+	}
+
+	return r
+}
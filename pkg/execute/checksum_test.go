@@ -0,0 +1,126 @@
+package execute
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestExecute_addChecksums(t *testing.T) {
+	const cm = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg
+data:
+  k: v
+`
+	tests := []struct {
+		it       string
+		previous string
+		docs     []string
+		// want are the checksum annotations on the pod template of the last doc.
+		want []string
+	}{
+		{
+			it: "should_annotate_deployment_with_volume",
+			docs: []string{cm, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: c
+      volumes:
+      - name: v
+        configMap:
+          name: cfg
+`},
+			want: []string{"checksum/cfg"},
+		},
+		{
+			it:       "should_annotate_cronjob_with_config_of_previous_step",
+			previous: cm,
+			docs: []string{`apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: c
+            envFrom:
+            - configMapRef:
+                name: cfg
+            env:
+            - name: X
+              valueFrom:
+                secretKeyRef:
+                  name: unknown
+                  key: x
+`},
+			want: []string{"checksum/cfg"},
+		},
+		{
+			it: "should_not_annotate_deployment_without_references",
+			docs: []string{cm, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: c
+`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{}
+			if tt.previous != "" {
+				assert.NoError(t, x.addChecksums([]object{{id: 1, sub: 1, doc: []byte(tt.previous)}}))
+			}
+			var objects []object
+			for i, d := range tt.docs {
+				objects = append(objects, object{id: 2, sub: i + 1, doc: []byte(d)})
+			}
+			err := x.addChecksums(objects)
+			if assert.NoError(t, err) {
+				last := string(objects[len(objects)-1].doc)
+				var got []string
+				for _, l := range strings.Split(last, "\n") {
+					if strings.Contains(l, ChecksumAnnotationPrefix) {
+						got = append(got, strings.TrimSpace(strings.SplitN(l, ":", 2)[0]))
+					}
+				}
+				assert.Equal(t, tt.want, got)
+				if tt.want != nil {
+					assert.Contains(t, last, "annotations:\n")
+				}
+			}
+		})
+	}
+}
+
+func Test_configHash(t *testing.T) {
+	a, err := decodeObject([]byte("kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  k: v\n"))
+	assert.NoError(t, err)
+	b, err := decodeObject([]byte("kind: ConfigMap\nmetadata:\n  name: a\n  labels:\n    x: y\ndata:\n  k: v\n"))
+	assert.NoError(t, err)
+	c, err := decodeObject([]byte("kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  k: w\n"))
+	assert.NoError(t, err)
+
+	ha, _ := configHash(a)
+	hb, _ := configHash(b)
+	hc, _ := configHash(c)
+	assert.Equal(t, ha, hb, "metadata doesn't change the hash")
+	assert.NotEqual(t, ha, hc, "data changes the hash")
+}
@@ -0,0 +1,158 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/backoff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+	"time"
+)
+
+// DefaultDeleteTimeout is the time to wait for objects to be deleted when Execute.DeleteTimeout isn't set.
+const defaultDeleteTimeout = 5 * time.Minute
+
+// Deletion is an object for which a delete has been issued.
+type deletion struct {
+	// resource name like deployments.apps
+	resource string
+	knsn     KindNamespaceName
+	// finalizers that block deletion (only set when deletion is pending)
+	finalizers []string
+}
+
+// WaitForDeletion waits until all objects are gone or DeleteTimeout expires.
+// It returns the objects that still exist with their finalizers.
+func (x *Execute) waitForDeletion(list []deletion) ([]deletion, error) {
+	end := time.Now().Add(x.deleteTimeout())
+
+	var pending []deletion
+	for _, d := range list {
+		var obj *unstructured.Unstructured
+		var err error
+		for exp := backoff.NewExponential(10 * time.Second); ; exp.Sleep() {
+			obj, err = x.getLive(d.resource, d.knsn)
+			if err != nil {
+				return nil, err
+			}
+			if obj == nil || time.Now().After(end) {
+				break
+			}
+		}
+		if obj != nil {
+			d.finalizers = obj.GetFinalizers()
+			pending = append(pending, d)
+		}
+	}
+
+	return pending, nil
+}
+
+// DeleteTimeout returns the max time to wait for objects to be deleted.
+func (x *Execute) deleteTimeout() time.Duration {
+	if x.DeleteTimeout > 0 {
+		return x.DeleteTimeout
+	}
+	return defaultDeleteTimeout
+}
+
+// CompleteDeletion waits for deleted objects to disappear.
+// Finalizers listed in removeFinalizers ("*" matches all) are removed from objects that are still present after
+// DeleteTimeout, use this for objects of which the controller is known to be gone.
+// An error listing the objects with their finalizers is returned when objects remain, the remaining objects are
+// returned as well (all of deleted when it's unknown which remain).
+func (x *Execute) completeDeletion(deleted []deletion, removeFinalizers []string) ([]deletion, error) {
+	pending, err := x.waitForDeletion(deleted)
+	if err != nil {
+		return deleted, err
+	}
+
+	if len(pending) > 0 && len(removeFinalizers) > 0 {
+		var patched []deletion
+		for _, d := range pending {
+			ok, err := x.removeFinalizers(d, removeFinalizers)
+			if err != nil {
+				return pending, err
+			}
+			if ok {
+				patched = append(patched, d)
+			}
+		}
+		if len(patched) > 0 {
+			p, err := x.waitForDeletion(pending)
+			if err != nil {
+				return pending, err
+			}
+			pending = p
+		}
+	}
+
+	if len(pending) > 0 {
+		return pending, fmt.Errorf("objects not deleted within %v:\n%s", x.deleteTimeout(), asPendingText(pending))
+	}
+
+	return nil, nil
+}
+
+// RemoveFinalizers removes the finalizers that match remove ("*" matches all) from the object in d.
+// It returns true when the object has been patched.
+func (x *Execute) removeFinalizers(d deletion, remove []string) (bool, error) {
+	var keep []string
+	for _, f := range d.finalizers {
+		if !matchFinalizer(f, remove) {
+			keep = append(keep, f)
+		}
+	}
+	if len(keep) == len(d.finalizers) {
+		return false, nil
+	}
+
+	p, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers": keep,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{"patch", d.resource, d.knsn.Name, "--type=merge", "-p", string(p)}
+	if d.knsn.Namespace != "" {
+		args = append(args, "-n", d.knsn.Namespace)
+	}
+	x.log("remove finalizers", 0, 0, "", strings.Join(args, " "))
+	_, _, err = x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		if isNotFound(err) {
+			// deleted in the meantime.
+			return false, nil
+		}
+		return false, fmt.Errorf("remove finalizers: %w", err)
+	}
+
+	return true, nil
+}
+
+// MatchFinalizer returns true when f is in list or list contains "*".
+func matchFinalizer(f string, list []string) bool {
+	for _, l := range list {
+		if l == "*" || l == f {
+			return true
+		}
+	}
+	return false
+}
+
+// AsPendingText returns a line per pending deletion with the finalizers that block it.
+func asPendingText(list []deletion) string {
+	var b strings.Builder
+	for _, d := range list {
+		b.WriteString(d.knsn.String())
+		if len(d.finalizers) > 0 {
+			b.WriteString(", finalizers: ")
+			b.WriteString(strings.Join(d.finalizers, " "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
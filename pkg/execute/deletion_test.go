@@ -0,0 +1,86 @@
+package execute
+
+import (
+	"context"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecute_completeDeletion(t *testing.T) {
+	tests := []struct {
+		it      string
+		remove  []string
+		wantErr string
+		// wantPatch is the expected patch command (if any).
+		wantPatch string
+	}{
+		{
+			it:      "should_report_objects_with_finalizers",
+			wantErr: "objects not deleted within 1ms:\n, v1, ConfigMap, ns, cm, finalizers: a.example.com b.example.com\n",
+		},
+		{
+			it:        "should_remove_listed_finalizers_only",
+			remove:    []string{"b.example.com"},
+			wantErr:   "objects not deleted within 1ms:\n, v1, ConfigMap, ns, cm, finalizers: a.example.com\n",
+			wantPatch: `patch configmaps. cm --type=merge -p {"metadata":{"finalizers":["a.example.com"]}} -n ns`,
+		},
+		{
+			it:        "should_remove_all_finalizers",
+			remove:    []string{"*"},
+			wantPatch: `patch configmaps. cm --type=merge -p {"metadata":{"finalizers":null}} -n ns`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			k := &fakeFinalizing{finalizers: []string{"a.example.com", "b.example.com"}}
+			x := &Execute{
+				Kubectl:       k,
+				DeleteTimeout: time.Millisecond,
+				Log:           logrtesting.TestLogger{T: t},
+			}
+			d := deletion{
+				resource: "configmaps.",
+				knsn:     KindNamespaceName{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Namespace: "ns", Name: "cm"},
+			}
+			pending, err := x.completeDeletion([]deletion{d}, tt.remove)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Len(t, pending, 1)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, pending)
+			}
+			assert.Equal(t, tt.wantPatch, k.patch)
+		})
+	}
+}
+
+// FakeFinalizing is an object that is being deleted but is blocked by finalizers.
+type fakeFinalizing struct {
+	finalizers []string
+	// patch is the last patch command.
+	patch string
+}
+
+func (k *fakeFinalizing) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	switch args[0] {
+	case "get":
+		if len(k.finalizers) == 0 {
+			return "", "", nil
+		}
+		return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns","finalizers":["` +
+			strings.Join(k.finalizers, `","`) + `"]}}`, "", nil
+	case "patch":
+		k.patch = strings.Join(args, " ")
+		if strings.Contains(k.patch, `"finalizers":null`) {
+			k.finalizers = nil
+		} else {
+			k.finalizers = k.finalizers[:1]
+		}
+	}
+	return "", "", nil
+}
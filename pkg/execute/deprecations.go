@@ -0,0 +1,146 @@
+package execute
+
+import (
+	_ "embed"
+	"fmt"
+	yaml2 "gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Deprecation is an API version (of a kind) that is deprecated and/or removed in a Kubernetes version.
+type Deprecation struct {
+	APIVersion string `yaml:"apiVersion"`
+	// Kind is empty for all kinds of the APIVersion.
+	Kind string `yaml:"kind"`
+	// DeprecatedIn and RemovedIn are Kubernetes versions like 1.16, empty when not deprecated or not removed.
+	DeprecatedIn string `yaml:"deprecatedIn"`
+	RemovedIn    string `yaml:"removedIn"`
+	// Replacement is the API version to use instead, empty when there's no replacement.
+	Replacement string `yaml:"replacement"`
+}
+
+// DeprecationsTable is the embedded table of deprecated and removed API versions.
+//
+//go:embed deprecations.yaml
+var deprecationsTable []byte
+
+// ReadDeprecations returns the embedded deprecations extended by the deprecations in file (if not empty).
+// Entries in file replace embedded entries with the same apiVersion and kind.
+func readDeprecations(file string) ([]Deprecation, error) {
+	var r []Deprecation
+	err := yaml2.Unmarshal(deprecationsTable, &r)
+	if err != nil {
+		return nil, fmt.Errorf("embedded deprecations: %w", err)
+	}
+	if file == "" {
+		return r, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("deprecations file: %w", err)
+	}
+	var ext []Deprecation
+	err = yaml2.Unmarshal(b, &ext)
+	if err != nil {
+		return nil, fmt.Errorf("deprecations file %s: %w", file, err)
+	}
+	for _, e := range ext {
+		if e.APIVersion == "" {
+			return nil, fmt.Errorf("deprecations file %s: entry without apiVersion", file)
+		}
+		for _, v := range []string{e.DeprecatedIn, e.RemovedIn} {
+			if _, ok := parseMinor(v); v != "" && !ok {
+				return nil, fmt.Errorf("deprecations file %s: %s %s: invalid version %s", file, e.APIVersion, e.Kind, v)
+			}
+		}
+
+		replaced := false
+		for i, d := range r {
+			if d.APIVersion == e.APIVersion && d.Kind == e.Kind {
+				r[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			r = append(r, e)
+		}
+	}
+
+	return r, nil
+}
+
+// DeprecationOf returns the deprecation of apiVersion and kind in deprecations or false when not found.
+// An entry for the specific kind takes precedence over an entry for all kinds of the apiVersion.
+func deprecationOf(deprecations []Deprecation, apiVersion, kind string) (Deprecation, bool) {
+	var r Deprecation
+	found := false
+	for _, d := range deprecations {
+		if d.APIVersion != apiVersion {
+			continue
+		}
+		if d.Kind == kind {
+			return d, true
+		}
+		if d.Kind == "" {
+			r, found = d, true
+		}
+	}
+	r.Kind = kind
+	return r, found
+}
+
+// Check returns true when d is removed in kubernetesVersion and a text describing the deprecation or removal.
+// The text is empty when the API version is still fine in kubernetesVersion.
+// Version master means the latest Kubernetes version.
+func (d Deprecation) check(kubernetesVersion string) (bool, string) {
+	target, ok := parseMinor(kubernetesVersion)
+	if !ok {
+		// master or unknown
+		target = [2]int{1 << 30, 0}
+	}
+
+	replacement := "there is no replacement"
+	if d.Replacement != "" {
+		replacement = "use " + d.Replacement
+	}
+
+	if v, ok := parseMinor(d.RemovedIn); ok && !lessMinor(target, v) {
+		return true, fmt.Sprintf("%s %s is removed in %s, %s", d.APIVersion, d.Kind, d.RemovedIn, replacement)
+	}
+	if v, ok := parseMinor(d.DeprecatedIn); ok && !lessMinor(target, v) {
+		s := fmt.Sprintf("%s %s is deprecated in %s", d.APIVersion, d.Kind, d.DeprecatedIn)
+		if d.RemovedIn != "" {
+			s += " and removed in " + d.RemovedIn
+		}
+		return false, s + ", " + replacement
+	}
+	return false, ""
+}
+
+// ParseMinor parses the major and minor number of a version like 1.20, 1.20.3 or v1.20.3.
+func parseMinor(version string) ([2]int, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return [2]int{}, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return [2]int{}, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return [2]int{}, false
+	}
+	return [2]int{major, minor}, true
+}
+
+// LessMinor returns true when version a is lower than version b.
+func lessMinor(a, b [2]int) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
@@ -0,0 +1,111 @@
+package execute
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeprecation_check(t *testing.T) {
+	tests := []struct {
+		it          string
+		apiVersion  string
+		kind        string
+		version     string
+		wantFound   bool
+		wantRemoved bool
+		wantText    string
+	}{
+		{
+			it:         "should_accept_api_version_before_deprecation",
+			apiVersion: "networking.k8s.io/v1beta1", kind: "Ingress", version: "1.18.3",
+			wantFound: true,
+		},
+		{
+			it:         "should_report_deprecated_api_version",
+			apiVersion: "networking.k8s.io/v1beta1", kind: "Ingress", version: "v1.20.0",
+			wantFound: true,
+			wantText:  "networking.k8s.io/v1beta1 Ingress is deprecated in 1.19 and removed in 1.22, use networking.k8s.io/v1",
+		},
+		{
+			it:         "should_report_removed_api_version",
+			apiVersion: "networking.k8s.io/v1beta1", kind: "Ingress", version: "1.22",
+			wantFound: true, wantRemoved: true,
+			wantText: "networking.k8s.io/v1beta1 Ingress is removed in 1.22, use networking.k8s.io/v1",
+		},
+		{
+			it:         "should_report_removed_api_version_of_all_kinds_in_master",
+			apiVersion: "rbac.authorization.k8s.io/v1beta1", kind: "Role", version: "master",
+			wantFound: true, wantRemoved: true,
+			wantText: "rbac.authorization.k8s.io/v1beta1 Role is removed in 1.22, use rbac.authorization.k8s.io/v1",
+		},
+		{
+			it:         "should_report_removal_without_replacement",
+			apiVersion: "policy/v1beta1", kind: "PodSecurityPolicy", version: "1.25",
+			wantFound: true, wantRemoved: true,
+			wantText: "policy/v1beta1 PodSecurityPolicy is removed in 1.25, there is no replacement",
+		},
+		{
+			it:         "should_not_find_current_api_version",
+			apiVersion: "apps/v1", kind: "Deployment", version: "master",
+		},
+	}
+
+	deprecations, err := readDeprecations("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			d, found := deprecationOf(deprecations, tt.apiVersion, tt.kind)
+			assert.Equal(t, tt.wantFound, found)
+			if !found {
+				return
+			}
+			removed, text := d.check(tt.version)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, tt.wantText, text)
+		})
+	}
+}
+
+func Test_readDeprecations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deprecations")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "deprecations.yaml")
+	err = ioutil.WriteFile(file, []byte(`
+- apiVersion: example.com/v1alpha1
+  removedIn: "1.20"
+  replacement: example.com/v1
+- apiVersion: batch/v1beta1
+  kind: CronJob
+  deprecatedIn: "1.19"
+  removedIn: "1.20"
+  replacement: batch/v1
+`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	deprecations, err := readDeprecations(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	d, ok := deprecationOf(deprecations, "example.com/v1alpha1", "Example")
+	if assert.True(t, ok) {
+		removed, text := d.check("1.20")
+		assert.True(t, removed)
+		assert.Equal(t, "example.com/v1alpha1 Example is removed in 1.20, use example.com/v1", text)
+	}
+
+	d, ok = deprecationOf(deprecations, "batch/v1beta1", "CronJob")
+	if assert.True(t, ok) {
+		assert.Equal(t, "1.20", d.RemovedIn, "embedded entry is replaced")
+	}
+}
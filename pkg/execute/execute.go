@@ -6,6 +6,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/mmlt/kubectl-tmplt/pkg/images"
+	"github.com/mmlt/kubectl-tmplt/pkg/policy"
 	"github.com/mmlt/kubectl-tmplt/pkg/util/backoff"
 	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
 	yaml2 "gopkg.in/yaml.v2"
@@ -13,6 +15,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"sort"
 	"strings"
 	"time"
 )
@@ -25,17 +28,63 @@ type Execute struct {
 	// NoDelete prevents prune from deleting resources.
 	NoDelete bool
 
+	// Adopt allows apply to take ownership of objects that are owned by another store.
+	Adopt bool
+
+	// DeleteTimeout is the max time to wait for deleted objects to disappear (default 5m).
+	DeleteTimeout time.Duration
+
+	// Force applies steps even when they are unchanged, see ApplyOpt.Incremental.
+	Force bool
+
+	// PruneBackupDir is the directory to write deleted objects to, it overrides PruneOpt.BackupDir.
+	PruneBackupDir string
+
 	// Environ are the environment variables on Tool invocation.
 	Environ []string
 
+	// SchemaDir is a directory with Kubernetes JSON schemas (kubeconform layout) used to lint objects.
+	SchemaDir string
+	// KubernetesVersion selects the schemas in SchemaDir like 1.20.0 (default master).
+	KubernetesVersion string
+	// CRDDir is a directory with CustomResourceDefinitions used to lint custom resources.
+	CRDDir string
+	// DeprecationsFile is a yaml file with Deprecations that extend the embedded deprecations table.
+	DeprecationsFile string
+
 	// Kubectl knows how to invoke 'kubectl'
 	Kubectl Kubectler
 
 	// Out is the stream to send steps to in a format that is 'kubectl apply -f -' consumable.
 	// Setting Out prevents any other processing (like 'wait') to take place.
 	Out io.Writer
+	// OutputDir is the directory to write generated steps to instead of Out, see BeginGenerate.
+	OutputDir string
+	// OutputFormat is the format of generated steps written to Out, see OutputFormat* constants.
+	OutputFormat string
 
 	Log logr.Logger
+
+	// discovered caches the API resources served by the target cluster, see getK8sAPIResources.
+	discovered *discovery
+	// manifests are the docs that have been applied, see Store.Manifests.
+	manifests [][]byte
+	// prevStepHashes are the step hashes of the previous run, see ApplyOpt.Incremental.
+	prevStepHashes map[string]string
+	// stepHashes are the step hashes of this run, they are written to the store by Prune.
+	stepHashes map[string]string
+	// preflight collects the required permissions instead of changing the target cluster, see BeginPreflight.
+	preflight *preflight
+	// lint validates objects instead of changing the target cluster, see BeginLint.
+	lint *lint
+	// output writes generated steps to OutputDir, see BeginGenerate.
+	output *output
+	// instructions are the generated steps that are written by EndGenerate, see OutputFormatJSON.
+	instructions []instruction
+	// jobKinds are the kinds created by CRDs in the job, see injectNamespace.
+	jobKinds []metav1.APIResource
+	// configHashes are the hashes of the ConfigMaps and Secrets applied in this run, see ApplyOpt.Checksums.
+	configHashes map[string]string
 }
 
 // Kubectler provides methods to invoke kubectl.
@@ -47,13 +96,22 @@ type Kubectler interface {
 func (x *Execute) Wait(id int, flags string) error {
 	args := append([]string{"wait"}, strings.Split(flags, " ")...)
 
+	if x.output != nil {
+		x.output.wait(id, args)
+		return nil
+	}
+
+	if x.Out != nil && x.isStructuredOutput() {
+		return x.instructWait(id, args)
+	}
+
 	if x.Out != nil {
 		fmt.Fprintln(x.Out, "---")
 		fmt.Fprintf(x.Out, "##%02d: %s %s\n", id, "InstrWait", args)
 		return nil
 	}
 
-	if x.DryRun {
+	if x.DryRun || x.preflight != nil || x.lint != nil {
 		return nil
 	}
 
@@ -75,57 +133,325 @@ func (x *Execute) Wait(id int, flags string) error {
 	return nil
 }
 
+// ApplyOpt are the options for Apply.
+type ApplyOpt struct {
+	// Labels to add to all objects.
+	Labels map[string]string
+	// Owner is the value of the OwnerAnnotation to add to all objects, see StoreOwner.
+	Owner string
+	// Annotations to add to the objects selected by AnnotationKinds.
+	Annotations map[string]string
+	// AnnotationKinds selects the kinds of objects that get Annotations, empty selects all kinds.
+	AnnotationKinds []string
+	// Checksums adds checksum/<name> annotations to the pod templates of workloads that reference ConfigMaps or
+	// Secrets that are rendered in the same job, see addChecksums.
+	Checksums bool
+	// Order in which the objects of a step are applied, see Order* constants.
+	Order string
+	// Batch applies the objects of a step with a single kubectl invocation, see applyBatches.
+	Batch bool
+	// Incremental skips applying a step when its objects and target cluster are the same as in the previous run and
+	// the objects still exist.
+	Incremental bool
+	// Store keeps the step hashes of the previous run (required for Incremental).
+	Store Store
+	// Policy is evaluated against all objects, violated deny rules fail the step, see checkPolicy.
+	Policy *policy.Policy
+	// Namespace is set on namespaced objects that don't have a namespace, see injectNamespace.
+	Namespace string
+	// SubjectNamespaces sets the namespace of RoleBinding and ClusterRoleBinding ServiceAccount subjects that don't
+	// have a namespace.
+	SubjectNamespaces bool
+	// Images rewrites and pins the container images of objects, see rewriteImages.
+	Images *images.Rewriter
+	// Patches modify the rendered objects before they are labelled, see applyPatches.
+	Patches []Patch
+	// PostRenderer transforms the rendered yaml before it's split into objects, see postRender.
+	PostRenderer *PostRenderer
+}
+
+// PruneOpt are the options for Prune.
+type PruneOpt struct {
+	// Order in which objects are deleted, see Order* constants.
+	Order string
+	// Wait for each deleted object to disappear (max Execute.DeleteTimeout).
+	Wait bool
+	// RemoveFinalizers lists the finalizers ("*" for all) that are removed from objects that are still present after
+	// Execute.DeleteTimeout. Use this for objects of which the controller is known to be gone.
+	RemoveFinalizers []string `yaml:"removeFinalizers"`
+	// BackupDir is the directory to write objects to before they are deleted.
+	// Each prune writes to a new timestamped sub-directory.
+	BackupDir string `yaml:"backupDir"`
+	// Store config.
+	Store Store
+	// JobHash identifies the job file in the store history.
+	JobHash string `yaml:"-"`
+}
+
+// Ordering strategies.
+const (
+	// OrderNone applies objects in the order they are rendered and deletes them in reverse order.
+	OrderNone = ""
+	// OrderKind applies objects in install order and deletes them in delete order.
+	// See lessInInstallOrder and sortInDeleteOrder.
+	OrderKind = "kind"
+)
+
 // Apply applies the yaml's in b to the target cluster.
-func (x *Execute) Apply(id int, name string, labels map[string]string, b []byte) ([]KindNamespaceName, error) {
+func (x *Execute) Apply(id int, name string, opt ApplyOpt, b []byte) ([]KindNamespaceName, error) {
+	if opt.PostRenderer != nil {
+		var err error
+		b, err = x.postRender(opt.PostRenderer, b)
+		if err != nil {
+			return nil, fmt.Errorf("tpl %s: %w", name, err)
+		}
+	}
+
 	docs, err := yamlx.SplitDoc(b)
 	if err != nil {
 		return nil, err
 	}
 
-	var resources []KindNamespaceName
+	// track is true when the applied objects are returned for pruning.
+	track := len(opt.Labels) > 0 || opt.Owner != ""
+
+	var objects []object
 
 	for i, doc := range docs {
 		if yamlx.IsEmpty(doc) {
 			continue
 		}
 
-		id2 := fmt.Sprintf("%02d.%02d", id, i+1)
+		// List documents are flattened into their items.
+		items, err := yamlx.ListItems(doc)
+		if err != nil {
+			return nil, fmt.Errorf("##%02d.%02d tpl %s: %w", id, i+1, name, err)
+		}
+		isList := items != nil
+		if !isList {
+			items = [][]byte{doc}
+		}
+
+		for j, item := range items {
+			o := object{id: id, sub: i + 1, doc: item}
+			if isList {
+				o.item = j + 1
+			}
+			objects = append(objects, o)
+		}
+	}
+
+	if len(opt.Patches) > 0 {
+		objects, err = applyPatches(name, objects, opt.Patches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, o := range objects {
+		// lint doesn't access the target cluster to discover namespaced kinds.
+		if opt.Namespace != "" && x.lint == nil {
+			o, err = x.injectNamespace(o, opt)
+			if err != nil {
+				return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
+		}
 
-		if len(labels) > 0 {
-			// When labels are defined the doc must be a Kubernetes resource.
-			d, knsn, err := updateObjectYaml(doc, labels)
+		if opt.Images != nil {
+			o, err = rewriteImages(o, opt.Images)
 			if err != nil {
-				return nil, fmt.Errorf("##%s tpl %s: %w", id2, name, err)
+				return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
 			}
-			resources = append(resources, knsn)
-			doc = d
 		}
 
-		args := []string{"apply", "-f", "-"}
-		if x.DryRun {
-			args = append(args, "--dry-run")
+		o, err = prepareObject(o, opt, track)
+		if err != nil {
+			return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
 		}
 
-		if x.Out != nil {
+		objects[i] = o
+	}
+
+	if opt.Checksums {
+		err = x.addChecksums(objects)
+		if err != nil {
+			return nil, fmt.Errorf("tpl %s: checksums: %w", name, err)
+		}
+	}
+
+	if opt.Policy != nil {
+		err = x.checkPolicy(name, opt.Policy, objects)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch opt.Order {
+	case OrderNone:
+	case OrderKind:
+		sort.SliceStable(objects, func(i, j int) bool {
+			return lessInInstallOrder(objects[i].knsn, objects[j].knsn)
+		})
+	default:
+		return nil, fmt.Errorf("tpl %s: unknown apply order: %s", name, opt.Order)
+	}
+
+	var resources []KindNamespaceName
+	if track {
+		for _, o := range objects {
+			resources = append(resources, o.knsn)
+		}
+	}
+
+	if x.lint != nil {
+		return resources, x.lintApply(name, objects)
+	}
+
+	if x.preflight != nil {
+		return resources, x.preflightApply(name, objects)
+	}
+
+	if x.output != nil {
+		return resources, x.output.apply(id, name, x.applyArgs(), objects)
+	}
+
+	if x.Out != nil && x.isStructuredOutput() {
+		return resources, x.instructApply(name, objects)
+	}
+
+	if x.Out != nil {
+		// generate
+		args := x.applyArgs()
+		for _, o := range objects {
 			fmt.Fprintln(x.Out, "---")
-			fmt.Fprintf(x.Out, "##%s: %s %s %s\n", id2, "InstrApply", args, name)
-			fmt.Fprintln(x.Out, string(doc))
+			fmt.Fprintf(x.Out, "##%s: %s %s %s\n", o.ID(), "InstrApply", args, name)
+			fmt.Fprintln(x.Out, string(o.doc))
+		}
+		return resources, nil
+	}
 
-			continue // generate or apply
+	if opt.Incremental && len(objects) > 0 {
+		key := stepKey(id, name)
+		hash, err := x.stepHash(objects)
+		if err != nil {
+			return nil, fmt.Errorf("tpl %s: %w", name, err)
+		}
+		unchanged, err := x.unchanged(opt.Store, key, hash, objects, opt.Owner)
+		if err != nil {
+			return nil, fmt.Errorf("tpl %s: %w", name, err)
 		}
+		if x.stepHashes == nil {
+			x.stepHashes = map[string]string{}
+		}
+		x.stepHashes[key] = hash
+		if unchanged {
+			for _, o := range objects {
+				x.manifests = append(x.manifests, o.doc)
+			}
+			x.log("apply", id, 0, name, "skipped: unchanged")
+			return resources, nil
+		}
+	}
 
-		stdout, _, err := x.Kubectl.Run(nil, string(doc), args...)
+	if opt.Batch {
+		err = x.applyBatches(name, opt, objects)
 		if err != nil {
-			return nil, fmt.Errorf("##%s tpl %s: %w", id2, name, err)
+			return nil, err
+		}
+		return resources, nil
+	}
+
+	for _, o := range objects {
+		if opt.Owner != "" && !x.Adopt {
+			err := x.checkOwner(o.doc, opt.Owner)
+			if err != nil {
+				return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
 		}
 
-		x.log("apply", id, i+1, name, stdout)
+		err := x.applyObject(name, o)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return resources, nil
 }
 
-func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error {
+// ApplyObject applies a single object and logs the result.
+func (x *Execute) applyObject(name string, o object) error {
+	stdout, _, err := x.Kubectl.Run(nil, string(o.doc), x.applyArgs()...)
+	if err != nil {
+		return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+	}
+
+	x.manifests = append(x.manifests, o.doc)
+
+	x.log("apply", o.id, o.sub, name, stdout)
+
+	return nil
+}
+
+// ApplyArgs returns the kubectl arguments to apply objects read from stdin.
+func (x *Execute) applyArgs() []string {
+	args := []string{"apply", "-f", "-"}
+	if x.DryRun {
+		args = append(args, "--dry-run")
+	}
+	return args
+}
+
+// PrepareObject adds labels and annotations to the doc of o and sets its knsn when needed by opt.
+func prepareObject(o object, opt ApplyOpt, track bool) (object, error) {
+	if track || len(opt.Annotations) > 0 {
+		// When labels, owner or annotations are defined the doc must be a Kubernetes resource.
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			return o, err
+		}
+		d, err := yamlx.AddMetadata(o.doc, opt.Labels, opt.annotations(obj.GetKind()))
+		if err != nil {
+			return o, err
+		}
+		o.doc, o.knsn = d, NewKindNamespaceName(obj)
+	} else if opt.Order != OrderNone || opt.Batch {
+		// When ordering or batching is defined the doc must be a Kubernetes resource.
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			return o, err
+		}
+		o.knsn = NewKindNamespaceName(obj)
+	}
+
+	return o, nil
+}
+
+// Object is a rendered document that is going to be applied.
+type object struct {
+	// id of the step and sub id (1 based index) of the document in the step.
+	id, sub int
+	// item is the 1 based index of the object in a List document or 0 when the document isn't a List.
+	item int
+	// doc is the yaml of the object.
+	doc []byte
+	// knsn identifies the object (only set when the doc has been decoded).
+	knsn KindNamespaceName
+}
+
+// ID returns the step.document identifier like 01.02 or step.document.item like 01.02.03 for List items.
+func (o object) ID() string {
+	if o.item > 0 {
+		return fmt.Sprintf("%02d.%02d.%02d", o.id, o.sub, o.item)
+	}
+	return fmt.Sprintf("%02d.%02d", o.id, o.sub)
+}
+
+// Prune deletes the objects that are in the store but not in deployed and writes deployed to the store.
+func (x *Execute) Prune(id int, deployed []KindNamespaceName, opt PruneOpt) error {
+	if x.preflight != nil {
+		return x.preflightPrune(id, deployed, opt)
+	}
+
 	idmin := 0
 
 	//TODO move to validation function (or separate validation tool?)
@@ -134,11 +460,22 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 		// same group/kind namespace/name used multiple times
 		x.log("prune WARNING; multiple deployments", id, idmin, "", k.String())
 	}
+	// rediscover because the cache might have been filled (by preflight or namespace defaulting) before the CRDs of
+	// the job were applied.
+	x.discovered = nil
 	apiResources, err := x.getK8sAPIResources()
 	if err != nil {
 		return err
 	}
-	invalid := invalidNamespace(deployed, apiResources)
+	var known []KindNamespaceName
+	for _, k := range deployed {
+		if x.isUnavailable(k.GVK.Group) {
+			// can't tell if the resource is namespaced.
+			continue
+		}
+		known = append(known, k)
+	}
+	invalid := invalidNamespace(known, apiResources)
 	if len(invalid) > 0 {
 		b := asCSV(invalid)
 		// namespace set on non-namespaced resource or namespace is missing (empty) on namespaced resource.
@@ -148,9 +485,9 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 	// Read configmap with previously deployed resources.
 	idmin++
 	x.log("prune", id, idmin, "", "read store")
-	cluster, err := x.readStore(store)
+	cluster, err := x.readStore(opt.Store)
 	if err != nil {
-		if strings.Contains(err.Error(), "Error from server (NotFound):") {
+		if isNotFound(err) {
 			idmin++
 			x.log("prune", id, idmin, "", "skipped: no store found")
 		} else {
@@ -161,9 +498,15 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 	// Diff what is in cluster but not in deployed.
 	toDelete := subtract(cluster, deployed)
 
-	// Delete objects in reverse order of creation.
-	reverse(toDelete)
-	// NB. an alternative is to use sortInDeleteOrder(toDelete)
+	switch opt.Order {
+	case OrderNone:
+		// Delete objects in reverse order of creation.
+		reverse(toDelete)
+	case OrderKind:
+		sortInDeleteOrder(toDelete)
+	default:
+		return fmt.Errorf("unknown prune order: %s", opt.Order)
+	}
 
 	if x.Log.V(5).Enabled() {
 		mustWriteAPIResourcesCSV(apiResources, "_apiresouces.txt")
@@ -173,9 +516,20 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 	}
 
 	// Delete
+	var deleted []deletion
+	backupDir := x.backupDir(opt)
 	for _, r := range toDelete {
 		rn, err := resource(r.GVK, apiResources)
 		if err != nil {
+			if isListKind(r.GVK) {
+				// recorded before List items were tracked individually.
+				idmin++
+				x.log("prune", id, idmin, "", "skipped "+r.GVK.Kind+" (items are tracked individually)")
+				continue
+			}
+			if x.isUnavailable(r.GVK.Group) {
+				return fmt.Errorf("%w (api group %s is unavailable)", err, r.GVK.Group)
+			}
 			return err
 		}
 		args := []string{"delete", rn, r.Name}
@@ -183,23 +537,74 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 			args = append(args, "-n", r.Namespace)
 		}
 		idmin++
+		live, err := x.getLive(rn, r)
+		if err != nil {
+			return fmt.Errorf("prune: %w", err)
+		}
+		if reason := pruneProtection(live, StoreOwner(opt.Store)); reason != "" {
+			x.log("prune", id, idmin, "", "skipped "+strings.Join(args, " ")+" ("+reason+")")
+			continue
+		}
 		if x.NoDelete || x.DryRun {
 			x.log("prune", id, idmin, "", "skipped "+strings.Join(args, " "))
 			continue
 		}
+		if opt.Wait {
+			args = append(args, "--wait=false")
+		}
+		if backupDir != "" {
+			err = x.backup(backupDir, live)
+			if err != nil {
+				return fmt.Errorf("prune backup: %w", err)
+			}
+		}
 		x.log("prune", id, idmin, "", strings.Join(args, " "))
 		_, _, err = x.Kubectl.Run(nil, "", args...)
 		if err != nil {
 			return fmt.Errorf("delete: %w", err)
 		}
+		deleted = append(deleted, deletion{resource: rn, knsn: r})
+	}
+
+	if opt.Wait && len(deleted) > 0 {
+		idmin++
+		x.log("prune", id, idmin, "", "wait for deletion")
+		pending, err := x.completeDeletion(deleted, opt.RemoveFinalizers)
+		if err != nil {
+			// keep the pending objects in the store so deletion is retried on the next run.
+			keep := append([]KindNamespaceName{}, deployed...)
+			for _, d := range pending {
+				keep = append(keep, d.knsn)
+			}
+			if err2 := x.writeStore(opt.Store, keep); err2 != nil {
+				return fmt.Errorf("prune: %v (write store: %w)", err, err2)
+			}
+			return fmt.Errorf("prune: %w", err)
+		}
 	}
 
 	// Write deployed to configmap
-	err = x.writeStore(store, deployed)
+	err = x.writeStore(opt.Store, deployed)
 	if err != nil {
 		return err
 	}
 
+	if x.stepHashes != nil {
+		err = x.writeStepHashes(opt.Store)
+		if err != nil {
+			return fmt.Errorf("prune write step hashes: %w", err)
+		}
+	}
+
+	if opt.Store.History > 0 {
+		idmin++
+		x.log("prune", id, idmin, "", "write history")
+		err = x.writeHistory(opt, deployed)
+		if err != nil {
+			return fmt.Errorf("prune write history: %w", err)
+		}
+	}
+
 	idmin++
 	x.log("prune", id, idmin, "", "done")
 	return nil
@@ -207,6 +612,14 @@ func (x *Execute) Prune(id int, deployed []KindNamespaceName, store Store) error
 
 // Action performs an action on the target cluster.
 func (x *Execute) Action(id int, name string, doc []byte, portForward string, passedValues *yamlx.Values) error {
+	if x.output != nil {
+		return x.output.action(id, name, portForward, doc)
+	}
+
+	if x.Out != nil && x.isStructuredOutput() {
+		return x.instructAction(id, name, portForward, doc)
+	}
+
 	if x.Out != nil {
 		var pf string
 		if portForward != "" {
@@ -234,6 +647,10 @@ func (x *Execute) Action(id int, name string, doc []byte, portForward string, pa
 		return err
 	}
 
+	if x.preflight != nil {
+		return x.preflightAction(id, name, ac.Type, doc, portForward)
+	}
+
 	x.log("action", id, 0, name, ac.Type)
 
 	switch ac.Type {
@@ -261,41 +678,27 @@ func (x *Execute) log(msg string, id, idmin int, tpl string, txt string) {
 		"tpl", tpl)
 }
 
-// UpdateObjectYaml adds labels to a k8s object and returns the updated yaml and its kind, namespace, name.
-func updateObjectYaml(doc []byte, labels map[string]string) ([]byte, KindNamespaceName, error) {
-	obj := &unstructured.Unstructured{}
-	dec := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	_, _, err := dec.Decode(doc, nil, obj)
-	if err != nil {
-		return nil, KindNamespaceName{}, err
-	}
-
-	l := obj.GetLabels()
-	for k, v := range labels {
-		if l == nil {
-			l = map[string]string{}
+// Annotations returns the annotations to add to an object of kind.
+func (opt ApplyOpt) annotations(kind string) map[string]string {
+	r := map[string]string{}
+	if policy.SelectKind(opt.AnnotationKinds, kind) {
+		for k, v := range opt.Annotations {
+			r[k] = v
 		}
-		l[k] = v
 	}
-	obj.SetLabels(l)
-
-	b, err := yaml2.Marshal(obj.Object)
-	if err != nil {
-		return nil, KindNamespaceName{}, err
+	if opt.Owner != "" {
+		r[OwnerAnnotation] = opt.Owner
 	}
-
-	return b, NewKindNamespaceName(obj), nil
+	return r
 }
 
-// GetK8sAPIResources returns all APIResources registered in the cluster.
-func (x *Execute) getK8sAPIResources() ([]metav1.APIResource, error) {
-	args := []string{"api-resources"}
-	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+// DecodeObject decodes a yaml doc into a k8s object.
+func decodeObject(doc []byte) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	dec := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+	_, _, err := dec.Decode(doc, nil, obj)
 	if err != nil {
-		return nil, fmt.Errorf("get api-resources: %w", err)
+		return nil, err
 	}
-
-	// process output
-	// NB. kubectl doesn't support api-resources json output yet.
-	return textToAPIResources(stdout)
+	return obj, nil
 }
@@ -1,26 +1,24 @@
 package execute
 
 import (
+	"bytes"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
 )
 
-func Test_updateObjectYaml(t *testing.T) {
-	type args struct {
-		doc    string
-		labels map[string]string
-	}
+func Test_prepareObject(t *testing.T) {
 	tests := []struct {
 		it      string
-		args    args
+		doc     string
+		opt     ApplyOpt
+		track   bool
 		wantDoc string
 		wantKNN KindNamespaceName
 	}{
 		{
 			it: "should handle Secret with data",
-			args: args{
-				doc: `
+			doc: `
 apiVersion: v1
 kind: Secret
 metadata:
@@ -28,24 +26,23 @@ metadata:
 type: Opaque
 data:
   hello: d29ybGQ=`,
-				labels: map[string]string{"key": "value"},
-			},
-			wantDoc: `apiVersion: v1
-data:
-  hello: d29ybGQ=
+			opt:   ApplyOpt{Labels: map[string]string{"key": "value"}},
+			track: true,
+			wantDoc: `
+apiVersion: v1
 kind: Secret
 metadata:
   labels:
     key: value
   name: envop-sp
 type: Opaque
-`,
+data:
+  hello: d29ybGQ=`,
 			wantKNN: KindNamespaceName{GVK: metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Secret"}, Namespace: "", Name: "envop-sp"},
 		},
 		{
 			it: "should handle Secret with stringData",
-			args: args{
-				doc: `
+			doc: `
 apiVersion: v1
 kind: Secret
 metadata:
@@ -53,28 +50,241 @@ metadata:
 type: Opaque
 stringData:
   hello: world`,
-				labels: map[string]string{"key": "value"},
-			},
-			wantDoc: `apiVersion: v1
+			opt:   ApplyOpt{Labels: map[string]string{"key": "value"}},
+			track: true,
+			wantDoc: `
+apiVersion: v1
 kind: Secret
 metadata:
   labels:
     key: value
   name: envop-sp
-stringData:
-  hello: world
 type: Opaque
-`,
+stringData:
+  hello: world`,
 			wantKNN: KindNamespaceName{GVK: metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Secret"}, Namespace: "", Name: "envop-sp"},
 		},
+		{
+			it: "should add annotations to selected kinds only",
+			doc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm`,
+			opt: ApplyOpt{Annotations: map[string]string{"a": "b"}, AnnotationKinds: []string{"Secret"}},
+			wantDoc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm`,
+			wantKNN: KindNamespaceName{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Name: "cm"},
+		},
+		{
+			it: "should leave doc and knsn alone when nothing is needed",
+			doc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm`,
+			wantDoc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := prepareObject(object{doc: []byte(tt.doc)}, tt.opt, tt.track)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantDoc, string(got.doc))
+				assert.Equal(t, tt.wantKNN, got.knsn)
+			}
+		})
+	}
+}
+
+func TestExecute_Apply(t *testing.T) {
+	tests := []struct {
+		it      string
+		opt     ApplyOpt
+		doc     string
+		wantOut string
+		wantKNN []KindNamespaceName
+	}{
+		{
+			it:  "should_apply_in_install_order_when_order_is_kind",
+			opt: ApplyOpt{Order: OrderKind},
+			doc: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: ns
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+`,
+			wantOut: `---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+
+---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: ns
+`,
+		},
+		{
+			it:  "should_return_deployed_objects_in_apply_order",
+			opt: ApplyOpt{Order: OrderKind, Labels: map[string]string{"key": "value"}},
+			doc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: ns
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+`,
+			wantOut: `---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: Namespace
+metadata:
+  labels:
+    key: value
+  name: ns
+
+---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    key: value
+  name: cm
+  namespace: ns
+`,
+			wantKNN: []KindNamespaceName{
+				{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "Namespace"}, Name: "ns"},
+				{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Namespace: "ns", Name: "cm"},
+			},
+		},
+		{
+			it: "should_annotate_selected_kinds_only",
+			opt: ApplyOpt{
+				Annotations:     map[string]string{"key": "value"},
+				AnnotationKinds: []string{"configmap"},
+			},
+			doc: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: sec
+`,
+			wantOut: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    key: value
+  name: cm
+---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: Secret
+metadata:
+  name: sec
+
+`,
+		},
+		{
+			it:  "should_flatten_list",
+			opt: ApplyOpt{Labels: map[string]string{"key": "value"}},
+			doc: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+`,
+			wantOut: `---
+##01.01.01: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    key: value
+  name: a
+
+---
+##01.01.02: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    key: value
+  name: b
+
+`,
+			wantKNN: []KindNamespaceName{
+				{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Name: "a"},
+				{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Name: "b"},
+			},
+		},
+		{
+			it:  "should_not_flatten_custom_kind_ending_with_list",
+			opt: ApplyOpt{Labels: map[string]string{"key": "value"}},
+			doc: `apiVersion: example.com/v1
+kind: AccessList
+metadata:
+  name: acl
+items:
+- name: a
+`,
+			wantOut: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: example.com/v1
+kind: AccessList
+metadata:
+  labels:
+    key: value
+  name: acl
+items:
+- name: a
+
+`,
+			wantKNN: []KindNamespaceName{
+				{GVK: metav1.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "AccessList"}, Name: "acl"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.it, func(t *testing.T) {
-			gotDoc, gotKNN, err := updateObjectYaml([]byte(tt.args.doc), tt.args.labels)
+			var out bytes.Buffer
+			x := &Execute{Out: &out}
+			got, err := x.Apply(1, "tpl", tt.opt, []byte(tt.doc))
 			if assert.NoError(t, err) {
-				assert.Equal(t, tt.wantDoc, string(gotDoc))
-				assert.Equal(t, tt.wantKNN, gotKNN)
+				assert.Equal(t, tt.wantOut, out.String())
+				assert.Equal(t, tt.wantKNN, got)
 			}
 		})
 	}
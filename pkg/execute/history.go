@@ -0,0 +1,199 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Revision is a deployment recorded in the store history.
+type Revision struct {
+	// Revision number, increments with each deployment.
+	Revision int
+	// Time of deployment in RFC3339 format.
+	Time string
+	// JobHash is the hash of the job file that was used for the deployment.
+	JobHash string
+	// X are the store X key/values at the time of deployment.
+	X map[string]string
+	// Deployed objects.
+	Deployed []KindNamespaceName
+	// Manifests are the applied objects as a multi-document yaml (only when store.manifests is set).
+	Manifests string
+}
+
+// History writes a table with the revisions in the store history to Out.
+func (x *Execute) History(opt PruneOpt) error {
+	if opt.Store.History <= 0 {
+		return fmt.Errorf("history: store.history is not set")
+	}
+
+	revs, err := x.readHistory(opt.Store)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(x.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tTIME\tOBJECTS\tMANIFESTS\tJOBHASH\tX")
+	for _, r := range revs {
+		var xs []string
+		for k, v := range r.X {
+			xs = append(xs, k+"="+v)
+		}
+		sort.Strings(xs)
+		fmt.Fprintf(w, "%d\t%s\t%d\t%t\t%s\t%s\n",
+			r.Revision, r.Time, len(r.Deployed), r.Manifests != "", r.JobHash, strings.Join(xs, ","))
+	}
+
+	return w.Flush()
+}
+
+// Rollback applies the manifests of a previous revision and prunes the objects that are not in that revision.
+func (x *Execute) Rollback(id int, revision int, opt PruneOpt) error {
+	if opt.Store.History <= 0 {
+		return fmt.Errorf("rollback: store.history is not set")
+	}
+
+	revs, err := x.readHistory(opt.Store)
+	if err != nil {
+		return err
+	}
+
+	var rev *Revision
+	for i := range revs {
+		if revs[i].Revision == revision {
+			rev = &revs[i]
+			break
+		}
+	}
+	if rev == nil {
+		return fmt.Errorf("rollback: revision %d not found in %s/%s", revision, opt.Store.Namespace, historyStore(opt.Store).Name)
+	}
+	if rev.Manifests == "" {
+		return fmt.Errorf("rollback: revision %d has no manifests (set store.manifests)", revision)
+	}
+
+	docs, err := yamlx.SplitDoc([]byte(rev.Manifests))
+	if err != nil {
+		return err
+	}
+
+	x.log("rollback", id, 0, "", "to revision "+strconv.Itoa(revision))
+
+	for i, doc := range docs {
+		if yamlx.IsEmpty(doc) {
+			continue
+		}
+
+		args := []string{"apply", "-f", "-"}
+		if x.DryRun {
+			args = append(args, "--dry-run")
+		}
+		stdout, _, err := x.Kubectl.Run(nil, string(doc), args...)
+		if err != nil {
+			return fmt.Errorf("##%02d.%02d rollback: %w", id, i+1, err)
+		}
+		x.manifests = append(x.manifests, doc)
+
+		x.log("rollback", id, i+1, "", stdout)
+	}
+
+	// record the rollback in the next revision.
+	xs := map[string]string{}
+	for k, v := range rev.X {
+		xs[k] = v
+	}
+	xs["rollback"] = strconv.Itoa(revision)
+	opt.Store.X = xs
+	opt.JobHash = rev.JobHash
+	// clear the step hashes so the next incremental run applies all steps.
+	x.stepHashes = map[string]string{}
+
+	return x.Prune(id+1, rev.Deployed, opt)
+}
+
+// WriteHistory adds a revision with deployed (and the applied manifests) to the store history.
+// The history is trimmed to the last store.history revisions.
+func (x *Execute) writeHistory(opt PruneOpt, deployed []KindNamespaceName) error {
+	revs, err := x.readHistory(opt.Store)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	n := 1
+	if len(revs) > 0 {
+		n = revs[len(revs)-1].Revision + 1
+	}
+	rev := Revision{
+		Revision: n,
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		JobHash:  opt.JobHash,
+		X:        opt.Store.X,
+		Deployed: deployed,
+	}
+	if opt.Store.Manifests {
+		rev.Manifests = string(joinDocs(x.manifests))
+	}
+	revs = append(revs, rev)
+	if len(revs) > opt.Store.History {
+		revs = revs[len(revs)-opt.Store.History:]
+	}
+
+	b, err := json.Marshal(revs)
+	if err != nil {
+		return err
+	}
+
+	return x.writeStoreData(historyStore(opt.Store), b)
+}
+
+// ReadHistory reads the revisions from the store history.
+func (x *Execute) readHistory(store Store) ([]Revision, error) {
+	hs := historyStore(store)
+	b, err := x.readStoreData(hs)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []Revision
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, fmt.Errorf("history %s/%s: %w", hs.Namespace, hs.Name, err)
+	}
+
+	return r, nil
+}
+
+// HistoryStore returns the config of the store that keeps the history of store.
+// The history is kept in a Secret when it contains manifests because those might include Secrets.
+func historyStore(store Store) Store {
+	kind := store.Kind
+	if store.Manifests {
+		kind = "Secret"
+	}
+	return Store{
+		Namespace: store.Namespace,
+		Name:      store.Name + "-history",
+		Kind:      kind,
+		Compress:  true,
+		ShardSize: store.ShardSize,
+	}
+}
+
+// JoinDocs joins yaml documents into a multi-document yaml.
+func joinDocs(docs [][]byte) []byte {
+	var r []byte
+	for _, d := range docs {
+		r = append(r, "---\n"...)
+		r = append(r, d...)
+		if len(d) > 0 && d[len(d)-1] != '\n' {
+			r = append(r, '\n')
+		}
+	}
+	return r
+}
@@ -0,0 +1,81 @@
+package execute
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestExecute_writeHistory(t *testing.T) {
+	deployed := []KindNamespaceName{
+		{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Namespace: "ns", Name: "cm1"},
+	}
+	opt := PruneOpt{
+		Store:   Store{Namespace: "default", Name: "st", History: 2, Manifests: true, X: map[string]string{"k": "v"}},
+		JobHash: "abc",
+	}
+
+	cluster := fakeCluster{}
+	x := &Execute{Kubectl: cluster}
+
+	for i := 0; i < 3; i++ {
+		x.manifests = [][]byte{[]byte("kind: ConfigMap")}
+		err := x.writeHistory(opt, deployed)
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	got, err := x.readHistory(opt.Store)
+	if assert.NoError(t, err) && assert.Len(t, got, 2) {
+		assert.Equal(t, 2, got[0].Revision)
+		assert.Equal(t, 3, got[1].Revision)
+		assert.Equal(t, "abc", got[1].JobHash)
+		assert.Equal(t, map[string]string{"k": "v"}, got[1].X)
+		assert.Equal(t, deployed, got[1].Deployed)
+		assert.Equal(t, "---\nkind: ConfigMap\n", got[1].Manifests)
+	}
+	assert.Equal(t, []string{"secret/st-history"}, cluster.names(), "manifests are kept in a Secret")
+
+	var out bytes.Buffer
+	x.Out = &out
+	err = x.History(opt)
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^REVISION\s+TIME\s+OBJECTS\s+MANIFESTS\s+JOBHASH\s+X\n2 .* 1 +true +abc +k=v\n3 `, out.String())
+	}
+
+	err = x.Rollback(1, 1, opt)
+	assert.EqualError(t, err, "rollback: revision 1 not found in default/st-history")
+}
+
+func Test_historyStore(t *testing.T) {
+	tests := []struct {
+		it    string
+		store Store
+		want  string
+	}{
+		{
+			it:    "should_use_store_kind_without_manifests",
+			store: Store{Name: "st", History: 2},
+			want:  "",
+		},
+		{
+			it:    "should_use_secret_when_manifests_are_kept",
+			store: Store{Name: "st", History: 2, Manifests: true},
+			want:  "Secret",
+		},
+		{
+			it:    "should_use_secret_when_manifests_are_kept_and_kind_is_configmap",
+			store: Store{Name: "st", Kind: "ConfigMap", History: 2, Manifests: true},
+			want:  "Secret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := historyStore(tt.store)
+			assert.Equal(t, tt.want, got.Kind)
+			assert.Equal(t, "st-history", got.Name)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package execute
+
+import (
+	"github.com/mmlt/kubectl-tmplt/pkg/images"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
+)
+
+// RewriteImages rewrites the container images of o with rw.
+// Images are found in the pod spec of Pods and workloads (see podTemplatePaths) and at the paths configured in rw.
+func rewriteImages(o object, rw *images.Rewriter) (object, error) {
+	obj, err := decodeObject(o.doc)
+	if err != nil {
+		return o, err
+	}
+	kind := obj.GetKind()
+
+	var specs [][]string
+	if kind == "Pod" {
+		specs = append(specs, []string{"spec"})
+	}
+	if p, ok := podTemplatePaths[kind]; ok {
+		specs = append(specs, append(append([]string{}, p...), "spec"))
+	}
+
+	var paths [][]string
+	for _, s := range specs {
+		for _, c := range []string{"initContainers", "containers", "ephemeralContainers"} {
+			paths = append(paths, append(append([]string{}, s...), c, "[]", "image"))
+		}
+	}
+	paths = append(paths, rw.Paths(kind)...)
+	if len(paths) == 0 {
+		return o, nil
+	}
+
+	o.doc, err = yamlx.ReplaceScalars(o.doc, paths, rw.Rewrite)
+	return o, err
+}
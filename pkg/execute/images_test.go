@@ -0,0 +1,67 @@
+package execute
+
+import (
+	"github.com/mmlt/kubectl-tmplt/pkg/images"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_rewriteImages(t *testing.T) {
+	tests := []struct {
+		it   string
+		in   string
+		want string
+	}{
+		{
+			it: "should_rewrite_images_in_pod_template",
+			in: `kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - image: busybox
+          containers:
+          - image: app:1
+`,
+			want: `kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - image: mirror.local/library/busybox
+          containers:
+          - image: mirror.local/library/app:1
+`,
+		},
+		{
+			it:   "should_rewrite_images_in_configured_paths",
+			in:   "kind: Example\nspec:\n  image: app:1\n",
+			want: "kind: Example\nspec:\n  image: mirror.local/library/app:1\n",
+		},
+		{
+			it:   "should_ignore_other_kinds",
+			in:   "kind: ConfigMap\ndata:\n  image: app:1\n",
+			want: "kind: ConfigMap\ndata:\n  image: app:1\n",
+		},
+	}
+
+	rw, err := images.New(images.Config{
+		Rewrite: []images.Rule{{From: "docker.io/*", To: "mirror.local/*"}},
+		Paths:   []images.Path{{Kind: "Example", Path: "spec.image"}},
+	}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := rewriteImages(object{doc: []byte(tt.in)}, rw)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(got.doc))
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package execute
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+)
+
+// StepKey returns the key of a step in the step hashes.
+func stepKey(id int, name string) string {
+	return fmt.Sprintf("%02d %s", id, name)
+}
+
+// StepHash returns the hash of the objects of a step applied to the target cluster.
+// The time annotation is left out because it changes on every run.
+func (x *Execute) stepHash(objects []object) (string, error) {
+	target, err := x.targetContext()
+	if err != nil {
+		return "", err
+	}
+
+	docs := make([][]byte, 0, len(objects))
+	for _, o := range objects {
+		doc, err := withoutTimeAnnotation(o.doc)
+		if err != nil {
+			return "", fmt.Errorf("##%s: %w", o.ID(), err)
+		}
+		docs = append(docs, doc)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(target))
+	h.Write([]byte{0})
+	h.Write(joinDocs(docs))
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// WithoutTimeAnnotation returns doc without TimeAnnotation (as JSON) or doc as is when it has no TimeAnnotation.
+func withoutTimeAnnotation(doc []byte) ([]byte, error) {
+	if !bytes.Contains(doc, []byte(TimeAnnotation)) {
+		return doc, nil
+	}
+	obj, err := decodeObject(doc)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "annotations", TimeAnnotation)
+	return obj.MarshalJSON()
+}
+
+// TargetContext returns the kubectl context and server of the target cluster.
+func (x *Execute) targetContext() (string, error) {
+	args := []string{"config", "view", "--minify", "-o", "jsonpath={.current-context} {.clusters[0].cluster.server}"}
+	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return "", fmt.Errorf("target context: %w", err)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// Unchanged returns true when the hash of the step with key is the same as in the previous run and all its objects
+// exist in the target cluster and are not owned by another store than owner.
+func (x *Execute) unchanged(store Store, key, hash string, objects []object, owner string) (bool, error) {
+	if x.Force {
+		return false, nil
+	}
+
+	if x.prevStepHashes == nil {
+		h, err := x.readStepHashes(store)
+		if err != nil {
+			return false, err
+		}
+		x.prevStepHashes = h
+	}
+	if x.prevStepHashes[key] != hash {
+		return false, nil
+	}
+
+	return x.exist(objects, owner)
+}
+
+// Exist returns true when all objects exist in the target cluster.
+// When owner is set (and objects aren't adopted) the objects must not be owned by another store either, otherwise
+// the step is applied so the owner check reports the object.
+func (x *Execute) exist(objects []object, owner string) (bool, error) {
+	docs := make([][]byte, 0, len(objects))
+	for _, o := range objects {
+		docs = append(docs, o.doc)
+	}
+
+	args := []string{"get", "-f", "-", "--ignore-not-found", "-o", "json"}
+	stdout, _, err := x.Kubectl.Run(nil, string(joinDocs(docs)), args...)
+	if err != nil {
+		if isUnknownKind(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get objects: %w", err)
+	}
+
+	live, err := decodeLiveObjects(stdout)
+	if err != nil {
+		return false, fmt.Errorf("get objects: %w", err)
+	}
+	if len(live) != len(objects) {
+		return false, nil
+	}
+	if owner != "" && !x.Adopt {
+		for _, obj := range live {
+			if o := obj.GetAnnotations()[OwnerAnnotation]; o != "" && o != owner {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// ReadStepHashes reads the step hashes of the previous run.
+// It returns an empty map when there is no previous run.
+func (x *Execute) readStepHashes(store Store) (map[string]string, error) {
+	r := map[string]string{}
+
+	b, err := x.readStoreData(stepsStore(store))
+	if err != nil {
+		if isNotFound(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, fmt.Errorf("step hashes %s/%s: %w", store.Namespace, stepsStore(store).Name, err)
+	}
+
+	return r, nil
+}
+
+// WriteStepHashes writes the step hashes of this run.
+func (x *Execute) writeStepHashes(store Store) error {
+	b, err := json.Marshal(x.stepHashes)
+	if err != nil {
+		return err
+	}
+
+	return x.writeStoreData(stepsStore(store), b)
+}
+
+// StepsStore returns the config of the store that keeps the step hashes of store.
+func stepsStore(store Store) Store {
+	return Store{
+		Namespace: store.Namespace,
+		Name:      store.Name + "-steps",
+		Kind:      store.Kind,
+		ShardSize: store.ShardSize,
+	}
+}
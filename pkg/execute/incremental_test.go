@@ -0,0 +1,137 @@
+package execute
+
+import (
+	"context"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestExecute_Apply_incremental(t *testing.T) {
+	const doc = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: ns
+`
+	tests := []struct {
+		it          string
+		doc         string
+		force       bool
+		missing     bool
+		owner       string
+		wantApplied int
+		wantErr     string
+	}{
+		{
+			it:          "should_skip_unchanged_step",
+			doc:         doc,
+			wantApplied: 0,
+		},
+		{
+			it:          "should_apply_changed_step",
+			doc:         doc + "data:\n  k: v\n",
+			wantApplied: 1,
+		},
+		{
+			it:          "should_apply_unchanged_step_when_objects_are_missing",
+			doc:         doc,
+			missing:     true,
+			wantApplied: 1,
+		},
+		{
+			it:      "should_not_skip_unchanged_step_when_objects_are_owned_by_another_store",
+			doc:     doc,
+			owner:   "other/st",
+			wantErr: "##01.01 tpl tpl: object is owned by store other/st (use --adopt to take ownership)",
+		},
+		{
+			it:          "should_apply_unchanged_step_when_forced",
+			doc:         doc,
+			force:       true,
+			wantApplied: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			store := Store{Namespace: "default", Name: "st"}
+			opt := ApplyOpt{Labels: map[string]string{"k": "v"}, Incremental: true, Store: store, Owner: StoreOwner(store)}
+
+			// previous run.
+			k := &fakeIncremental{cluster: fakeCluster{}, owner: opt.Owner}
+			x := &Execute{Kubectl: k, Log: logrtesting.TestLogger{T: t}}
+			_, err := x.Apply(1, "tpl", opt, []byte(doc))
+			assert.NoError(t, err)
+			assert.NoError(t, x.writeStepHashes(store))
+
+			// this run.
+			k.applied, k.missing = 0, tt.missing
+			if tt.owner != "" {
+				k.owner = tt.owner
+			}
+			x = &Execute{Kubectl: k, Force: tt.force, Log: logrtesting.TestLogger{T: t}}
+			got, err := x.Apply(1, "tpl", opt, []byte(tt.doc))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Equal(t, 0, k.applied)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantApplied, k.applied)
+				assert.Len(t, got, 1, "deployed objects")
+			}
+		})
+	}
+}
+
+func TestExecute_Apply_incremental_timeAnnotation(t *testing.T) {
+	const doc = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  namespace: ns\n"
+	store := Store{Namespace: "default", Name: "st"}
+	opt := ApplyOpt{Incremental: true, Store: store}
+
+	// previous run.
+	k := &fakeIncremental{cluster: fakeCluster{}}
+	x := &Execute{Kubectl: k, Log: logrtesting.TestLogger{T: t}}
+	opt.Annotations = map[string]string{TimeAnnotation: "2020-05-18T17:11:11Z", "keep": "me"}
+	_, err := x.Apply(1, "tpl", opt, []byte(doc))
+	assert.NoError(t, err)
+	assert.NoError(t, x.writeStepHashes(store))
+
+	// this run.
+	k.applied = 0
+	x = &Execute{Kubectl: k, Log: logrtesting.TestLogger{T: t}}
+	opt.Annotations = map[string]string{TimeAnnotation: "2020-05-19T08:00:00Z", "keep": "me"}
+	_, err = x.Apply(1, "tpl", opt, []byte(doc))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, k.applied, "a new time doesn't change the step")
+	}
+}
+
+// FakeIncremental counts the applied objects and keeps the store in an in-memory cluster.
+type fakeIncremental struct {
+	cluster fakeCluster
+	// applied is the number of apply invocations of non-store objects.
+	applied int
+	// missing makes get report no objects.
+	missing bool
+	// owner is the owner annotation of the live object.
+	owner string
+}
+
+func (k *fakeIncremental) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	switch {
+	case args[0] == "config":
+		return "ctx https://cluster", "", nil
+	case args[0] == "get" && args[1] == "-f":
+		if k.missing {
+			return "", "", nil
+		}
+		return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns","annotations":{"` +
+			OwnerAnnotation + `":"` + k.owner + `"}}}`, "", nil
+	case args[0] == "apply" && !strings.HasPrefix(stdin, "{"):
+		k.applied++
+		return "configmap/cm configured", "", nil
+	}
+	return k.cluster.Run(ctx, stdin, args...)
+}
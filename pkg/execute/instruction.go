@@ -0,0 +1,112 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of generate.
+const (
+	// OutputFormatText writes '##' instruction comments followed by the 'kubectl apply -f -' consumable objects.
+	OutputFormatText = "text"
+	// OutputFormatJSON writes a JSON array of instructions, see EndGenerate.
+	OutputFormatJSON = "json"
+	// OutputFormatJSONL writes an instruction per line (JSON Lines).
+	OutputFormatJSONL = "jsonl"
+)
+
+// Instruction is a machine readable generated step (OutputFormatJSON and OutputFormatJSONL).
+type instruction struct {
+	// ID is the step.document id like 01.02 of an applied object or the step id like 02 of a wait or action.
+	ID string `json:"id"`
+	// Type of step; tmplt, wait or action.
+	Type string `json:"type"`
+	// Template is the name of the template (tmplt and action only).
+	Template string `json:"template,omitempty"`
+	// Args are the kubectl arguments to apply the object or wait for a condition.
+	Args []string `json:"args,omitempty"`
+	// PortForward are the 'kubectl port-forward' flags of an action.
+	PortForward string `json:"portForward,omitempty"`
+	// Object is the object to apply.
+	Object json.RawMessage `json:"object,omitempty"`
+	// Action is the action document.
+	Action json.RawMessage `json:"action,omitempty"`
+}
+
+// IsStructuredOutput returns true when generate writes instructions instead of text.
+func (x *Execute) isStructuredOutput() bool {
+	return x.OutputFormat == OutputFormatJSON || x.OutputFormat == OutputFormatJSONL
+}
+
+// InstructApply writes an apply instruction per object.
+func (x *Execute) instructApply(name string, objects []object) error {
+	args := x.applyArgs()
+	for _, o := range objects {
+		doc, err := docJSON(o.doc)
+		if err != nil {
+			return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+		}
+		err = x.writeInstruction(instruction{ID: o.ID(), Type: "tmplt", Template: name, Args: args, Object: doc})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstructWait writes a wait instruction.
+func (x *Execute) instructWait(id int, args []string) error {
+	return x.writeInstruction(instruction{ID: fmt.Sprintf("%02d", id), Type: "wait", Args: args})
+}
+
+// InstructAction writes an action instruction.
+func (x *Execute) instructAction(id int, name, portForward string, doc []byte) error {
+	d, err := docJSON(doc)
+	if err != nil {
+		return fmt.Errorf("##%02d action %s: %w", id, name, err)
+	}
+	return x.writeInstruction(instruction{ID: fmt.Sprintf("%02d", id), Type: "action", Template: name,
+		PortForward: portForward, Action: d})
+}
+
+// WriteInstruction writes in to Out (OutputFormatJSONL) or keeps it to be written by EndGenerate (OutputFormatJSON).
+func (x *Execute) writeInstruction(in instruction) error {
+	if x.OutputFormat == OutputFormatJSON {
+		x.instructions = append(x.instructions, in)
+		return nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(x.Out, string(b))
+	return err
+}
+
+// WriteInstructions writes the instructions kept since BeginGenerate as a JSON array (OutputFormatJSON only).
+func (x *Execute) writeInstructions() error {
+	ins := x.instructions
+	x.instructions = nil
+	if x.OutputFormat != OutputFormatJSON {
+		return nil
+	}
+	if ins == nil {
+		ins = []instruction{}
+	}
+	b, err := json.MarshalIndent(ins, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(x.Out, string(b))
+	return err
+}
+
+// DocJSON returns the yaml doc as JSON.
+func docJSON(doc []byte) (json.RawMessage, error) {
+	b, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
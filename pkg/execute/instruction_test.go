@@ -0,0 +1,85 @@
+package execute
+
+import (
+	"bytes"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecute_generate_outputFormat(t *testing.T) {
+	tests := []struct {
+		it     string
+		format string
+		want   string
+	}{
+		{
+			it:     "should_write_an_instruction_per_line",
+			format: OutputFormatJSONL,
+			want: `{"id":"01.01","type":"tmplt","template":"tpl","args":["apply","-f","-"],"object":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm"}}}
+{"id":"02","type":"wait","args":["wait","--for","condition=available","deploy/app"]}
+{"id":"03","type":"action","template":"action","portForward":"svc/vault 8200","action":{"name":"sec","type":"getSecret"}}
+`,
+		},
+		{
+			it:     "should_write_an_array_of_instructions",
+			format: OutputFormatJSON,
+			want: `[
+  {
+    "id": "01.01",
+    "type": "tmplt",
+    "template": "tpl",
+    "args": [
+      "apply",
+      "-f",
+      "-"
+    ],
+    "object": {
+      "apiVersion": "v1",
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "cm"
+      }
+    }
+  },
+  {
+    "id": "02",
+    "type": "wait",
+    "args": [
+      "wait",
+      "--for",
+      "condition=available",
+      "deploy/app"
+    ]
+  },
+  {
+    "id": "03",
+    "type": "action",
+    "template": "action",
+    "portForward": "svc/vault 8200",
+    "action": {
+      "name": "sec",
+      "type": "getSecret"
+    }
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var out bytes.Buffer
+			x := &Execute{Out: &out, OutputFormat: tt.format, Log: logrtesting.TestLogger{T: t}}
+			if !assert.NoError(t, x.BeginGenerate()) {
+				return
+			}
+			_, err := x.Apply(1, "tpl", ApplyOpt{}, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"))
+			assert.NoError(t, err)
+			assert.NoError(t, x.Wait(2, "--for condition=available deploy/app"))
+			assert.NoError(t, x.Action(3, "action", []byte("type: getSecret\nname: sec\n"), "svc/vault 8200", nil))
+			if assert.NoError(t, x.EndGenerate()) {
+				assert.Equal(t, tt.want, out.String())
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sort"
+	"strings"
 )
 
 // KindNamespaceName
@@ -88,60 +89,47 @@ func duplicates(list []KindNamespaceName) []KindNamespaceName {
 	return r
 }
 
-// SortInDeleteOrder sorts list in place.
-// Sort order:
+// SortInDeleteOrder sorts list in place, objects with the same rank keep their order.
+// Delete order:
+//
 //	(Mutating)WebhookConfiguration first
-//  namespaced before non-namespaced
-//	workloads before other namespaced resources
-//	CustomResourceDefinition last
+//	incoming traffic (APIService, Ingress, Service)
+//	workloads
+//	other namespaced kinds
+//	other non-namespaced kinds
+//	CustomResourceDefinition last (deleting a CRD deletes its custom resources)
 func sortInDeleteOrder(list []KindNamespaceName) {
-	sort.Slice(list, func(i, j int) bool {
-		// WebhookConfigurations first
-		if before(list[i].GVK.Kind, list[j].GVK.Kind, "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration") {
-			return true
-		}
-
-		// namespaced before non-namespaced
-		if list[i].Namespace > list[j].Namespace {
-			return true
-		}
-		if list[i].Namespace < list[j].Namespace {
-			return false
-		}
-
-		// incoming traffic
-		if before(list[i].GVK.Kind, list[j].GVK.Kind, "APIService", "Ingress", "Service") {
-			return true
-		}
-
-		// workloads
-		if before(list[i].GVK.Kind, list[j].GVK.Kind, "CronJob", "Job", "StatefulSet") {
-			return true
-		}
-		if before(list[i].GVK.Kind, list[j].GVK.Kind, "HorizontalPodAutoscaler") {
-			return true
-		}
-		if before(list[i].GVK.Kind, list[j].GVK.Kind, "Deployment", "ReplicaSet", "ReplicationController", "Pod", "DaemonSet") {
-			return true
-		}
-
-		// https://github.com/helm/helm/blob/release-2.16/pkg/tiller/kind_sorter.go
-		return false
+	sort.SliceStable(list, func(i, j int) bool {
+		return deleteRank(list[i]) < deleteRank(list[j])
 	})
 }
 
-// Before returns true when l is in list and r isn't.
-func before(l, r string, list ...string) bool {
-	in := func(e string, list ...string) bool {
-		for _, v := range list {
-			if e == v {
-				return true
+// DeleteOrder lists groups of kinds in the order they should be deleted.
+// See https://github.com/helm/helm/blob/release-2.16/pkg/tiller/kind_sorter.go
+var deleteOrder = [][]string{
+	{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"},
+	{"APIService", "Ingress", "Service"},
+	{"CronJob", "Job", "StatefulSet"},
+	{"HorizontalPodAutoscaler"},
+	{"Deployment", "ReplicaSet", "ReplicationController", "Pod", "DaemonSet"},
+}
+
+// DeleteRank returns the position of o in the delete order.
+func deleteRank(o KindNamespaceName) int {
+	for i, kinds := range deleteOrder {
+		for _, k := range kinds {
+			if k == o.GVK.Kind {
+				return i
 			}
 		}
-		return false
 	}
-
-	return in(l, list...) && !in(r, list...)
+	switch {
+	case o.GVK.Kind == "CustomResourceDefinition":
+		return len(deleteOrder) + 2
+	case o.Namespace == "":
+		return len(deleteOrder) + 1
+	}
+	return len(deleteOrder)
 }
 
 // MustWriteCSV writes a CSV file with list for debugging purposes.
@@ -223,3 +211,76 @@ func invalidNamespace(list []KindNamespaceName, resources []metav1.APIResource)
 	}
 	return r
 }
+
+// InstallOrder lists kinds in the order they should be installed.
+// The empty string marks the position of kinds that are not listed (like custom resources).
+var installOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"PodSecurityPolicy",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodDisruptionBudget",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+	"",
+	"MutatingWebhookConfiguration",
+	"ValidatingWebhookConfiguration",
+}
+
+// LessInInstallOrder returns true when l should be installed before r.
+// Install order:
+//
+//	Namespace first
+//	CustomResourceDefinition
+//	RBAC
+//	ConfigMap, Secret
+//	Service
+//	workloads
+//	other kinds (like custom resources)
+//	(Mutating)WebhookConfiguration last
+func lessInInstallOrder(l, r KindNamespaceName) bool {
+	return installRank(l.GVK.Kind) < installRank(r.GVK.Kind)
+}
+
+// InstallRank returns the position of kind in installOrder.
+func installRank(kind string) int {
+	other := 0
+	for i, k := range installOrder {
+		if k == kind {
+			return i
+		}
+		if k == "" {
+			other = i
+		}
+	}
+	return other
+}
+
+// IsListKind returns true when gvk is a core List kind like List or ConfigMapList.
+// Kinds of other groups (for example a custom resource AccessList) are not Lists.
+func isListKind(gvk metav1.GroupVersionKind) bool {
+	return gvk.Group == "" && strings.HasSuffix(gvk.Kind, "List")
+}
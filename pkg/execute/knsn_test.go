@@ -0,0 +1,114 @@
+package execute
+
+import (
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+	"testing"
+)
+
+func Test_lessInInstallOrder(t *testing.T) {
+	knsn := func(kind, name string) KindNamespaceName {
+		return KindNamespaceName{GVK: metav1.GroupVersionKind{Kind: kind}, Name: name}
+	}
+
+	tests := []struct {
+		it   string
+		list []KindNamespaceName
+		want []KindNamespaceName
+	}{
+		{
+			it: "should_install_namespace_crd_rbac_config_service_workload_cr_webhook",
+			list: []KindNamespaceName{
+				knsn("ValidatingWebhookConfiguration", "a"),
+				knsn("Certificate", "b"),
+				knsn("Deployment", "c"),
+				knsn("Service", "d"),
+				knsn("ConfigMap", "e"),
+				knsn("RoleBinding", "f"),
+				knsn("ServiceAccount", "g"),
+				knsn("CustomResourceDefinition", "h"),
+				knsn("Namespace", "i"),
+			},
+			want: []KindNamespaceName{
+				knsn("Namespace", "i"),
+				knsn("CustomResourceDefinition", "h"),
+				knsn("ServiceAccount", "g"),
+				knsn("RoleBinding", "f"),
+				knsn("ConfigMap", "e"),
+				knsn("Service", "d"),
+				knsn("Deployment", "c"),
+				knsn("Certificate", "b"),
+				knsn("ValidatingWebhookConfiguration", "a"),
+			},
+		},
+		{
+			it: "should_keep_order_of_same_kind",
+			list: []KindNamespaceName{
+				knsn("Secret", "b"),
+				knsn("Namespace", "x"),
+				knsn("Secret", "a"),
+			},
+			want: []KindNamespaceName{
+				knsn("Namespace", "x"),
+				knsn("Secret", "b"),
+				knsn("Secret", "a"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			sort.SliceStable(tt.list, func(i, j int) bool {
+				return lessInInstallOrder(tt.list[i], tt.list[j])
+			})
+			assert.Equal(t, tt.want, tt.list)
+		})
+	}
+}
+
+func Test_sortInDeleteOrder(t *testing.T) {
+	knsn := func(kind, namespace, name string) KindNamespaceName {
+		return KindNamespaceName{GVK: metav1.GroupVersionKind{Kind: kind}, Namespace: namespace, Name: name}
+	}
+
+	list := []KindNamespaceName{
+		knsn("CustomResourceDefinition", "", "certificates.example.com"),
+		knsn("ConfigMap", "ns", "cm"),
+		knsn("Certificate", "ns", "cert"),
+		knsn("Deployment", "ns", "app"),
+		knsn("ClusterRole", "", "role"),
+		knsn("Service", "ns", "svc"),
+		knsn("StatefulSet", "ns", "db"),
+		knsn("ValidatingWebhookConfiguration", "", "hook"),
+	}
+	sortInDeleteOrder(list)
+
+	assert.Equal(t, []KindNamespaceName{
+		knsn("ValidatingWebhookConfiguration", "", "hook"),
+		knsn("Service", "ns", "svc"),
+		knsn("StatefulSet", "ns", "db"),
+		knsn("Deployment", "ns", "app"),
+		knsn("ConfigMap", "ns", "cm"),
+		knsn("Certificate", "ns", "cert"),
+		knsn("ClusterRole", "", "role"),
+		knsn("CustomResourceDefinition", "", "certificates.example.com"),
+	}, list)
+}
+
+func Test_isListKind(t *testing.T) {
+	tests := []struct {
+		it   string
+		gvk  metav1.GroupVersionKind
+		want bool
+	}{
+		{it: "should_be_true_for_list", gvk: metav1.GroupVersionKind{Version: "v1", Kind: "List"}, want: true},
+		{it: "should_be_true_for_core_typed_list", gvk: metav1.GroupVersionKind{Kind: "ConfigMapList"}, want: true},
+		{it: "should_be_false_for_custom_kind", gvk: metav1.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "AccessList"}},
+		{it: "should_be_false_for_other_kinds", gvk: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, isListKind(tt.gvk))
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package execute
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Lint validates rendered objects against JSON schemas.
+type lint struct {
+	compiler *jsonschema.Compiler
+	// schemas are the compiled schemas by path or url, nil when the schema doesn't exist.
+	schemas map[string]*jsonschema.Schema
+	// crds are the urls of the schemas of CRD versions by group/version/kind.
+	crds map[string]string
+	// deprecations are the deprecated and removed API versions.
+	deprecations []Deprecation
+
+	// issues are the validation errors found in the rendered objects.
+	issues []issue
+}
+
+// BeginLint makes subsequent Apply calls validate objects instead of changing the target cluster.
+// The CRDs in CRDDir are read so their schemas can be used to validate custom resources.
+func (x *Execute) BeginLint() error {
+	deprecations, err := readDeprecations(x.DeprecationsFile)
+	if err != nil {
+		return err
+	}
+
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft4
+	l := &lint{
+		compiler:     c,
+		schemas:      map[string]*jsonschema.Schema{},
+		crds:         map[string]string{},
+		deprecations: deprecations,
+	}
+
+	if x.CRDDir != "" {
+		files, err := ioutil.ReadDir(x.CRDDir)
+		if err != nil {
+			return fmt.Errorf("crd-dir: %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || !isYamlFile(f.Name()) {
+				continue
+			}
+			p := filepath.Join(x.CRDDir, f.Name())
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("crd-dir: %w", err)
+			}
+			err = l.addCRDs(b)
+			if err != nil {
+				return fmt.Errorf("crd-dir %s: %w", p, err)
+			}
+		}
+	}
+
+	x.lint = l
+	return nil
+}
+
+// EndLint returns an error with a table of the validation errors found since BeginLint.
+func (x *Execute) EndLint() error {
+	l := x.lint
+	x.lint = nil
+	if l == nil || len(l.issues) == 0 {
+		return nil
+	}
+	return fmt.Errorf("lint: %d errors:\n%s", len(l.issues), issuesTable(l.issues))
+}
+
+// LintApply validates objects against the Kubernetes schemas in SchemaDir or the schemas of CRDs.
+// API versions that are removed in KubernetesVersion are reported as error, deprecated API versions are logged.
+// CRDs in objects are added to the known CRDs so custom resources in this or a next step can be validated.
+func (x *Execute) lintApply(name string, objects []object) error {
+	l := x.lint
+
+	for _, o := range objects {
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			l.issue(o, name, err.Error())
+			continue
+		}
+		gvk := obj.GroupVersionKind()
+
+		if d, ok := deprecationOf(l.deprecations, obj.GetAPIVersion(), obj.GetKind()); ok {
+			removed, text := d.check(x.KubernetesVersion)
+			switch {
+			case removed:
+				l.issue(o, name, text)
+			case text != "":
+				x.Log.Info("lint WARNING; deprecated api", "id", o.ID(), "txt", text, "tpl", name)
+			}
+		}
+
+		s, err := x.schema(gvk.Group, gvk.Version, gvk.Kind)
+		if err != nil {
+			return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+		}
+		if s == nil {
+			if x.SchemaDir != "" {
+				l.issue(o, name, "no schema for kind "+gvkString(metav1.GroupVersionKind(gvk)))
+			}
+		} else {
+			for _, e := range validationErrors(s.Validate(obj.Object)) {
+				l.issue(o, name, e)
+			}
+		}
+
+		if gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition" {
+			err = l.addCRD(obj)
+			if err != nil {
+				return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Issue records a validation error of object o.
+func (l *lint) issue(o object, tpl, text string) {
+	l.issues = append(l.issues, issue{id: o.ID(), tpl: tpl, text: text})
+}
+
+// Schema returns the compiled schema of group, version, kind or nil when there is no schema.
+// The schema of a CRD is preferred over the schemas in SchemaDir.
+func (x *Execute) schema(group, version, kind string) (*jsonschema.Schema, error) {
+	l := x.lint
+
+	var paths []string
+	if u, ok := l.crds[gvkKey(group, version, kind)]; ok {
+		paths = append(paths, u)
+	}
+	if x.SchemaDir != "" {
+		paths = append(paths, schemaPaths(x.SchemaDir, x.KubernetesVersion, group, version, kind)...)
+	}
+
+	for _, p := range paths {
+		if s, ok := l.schemas[p]; ok {
+			if s != nil {
+				return s, nil
+			}
+			continue
+		}
+		if !strings.HasPrefix(p, crdSchemaURL) {
+			if _, err := os.Stat(p); err != nil {
+				l.schemas[p] = nil
+				continue
+			}
+		}
+		s, err := l.compiler.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", p, err)
+		}
+		l.schemas[p] = s
+		return s, nil
+	}
+
+	return nil, nil
+}
+
+// SchemaPaths returns the paths of the files in dir that can contain the schema of group, version, kind.
+// The layout of dir is the same as used by kubeconform; <version>-standalone-strict/<kind>[-<group>]-<version>.json
+// for Kubernetes kinds (group is the first part of the API group name) and <group>/<kind>_<version>.json for custom
+// resources.
+func schemaPaths(dir, kubernetesVersion, group, version, kind string) []string {
+	kv := kubernetesVersion
+	if kv == "" {
+		kv = "master"
+	}
+	if kv != "master" && !strings.HasPrefix(kv, "v") {
+		kv = "v" + kv
+	}
+
+	k := strings.ToLower(kind)
+	name := k + "-" + version + ".json"
+	if group != "" {
+		name = k + "-" + strings.Split(group, ".")[0] + "-" + version + ".json"
+	}
+
+	r := []string{
+		filepath.Join(dir, kv+"-standalone-strict", name),
+		filepath.Join(dir, kv+"-standalone", name),
+	}
+	if group != "" {
+		r = append(r, filepath.Join(dir, group, k+"_"+version+".json"))
+	}
+	return r
+}
+
+// CrdSchemaURL is the url prefix of schemas that are derived from CRDs.
+const crdSchemaURL = "file:///crd/"
+
+// AddCRDs adds the CRDs in the yaml docs in b.
+func (l *lint) addCRDs(b []byte) error {
+	docs, err := yamlx.SplitDoc(b)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if yamlx.IsEmpty(doc) {
+			continue
+		}
+		obj, err := decodeObject(doc)
+		if err != nil {
+			return err
+		}
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		err = l.addCRD(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCRD adds a schema per version of crd.
+// Both apiextensions.k8s.io/v1 (schema per version) and v1beta1 (optionally a single schema) CRDs are supported.
+func (l *lint) addCRD(crd *unstructured.Unstructured) error {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	common, _, _ := unstructured.NestedMap(crd.Object, "spec", "validation", "openAPIV3Schema")
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if v, ok, _ := unstructured.NestedString(crd.Object, "spec", "version"); ok && len(versions) == 0 {
+		versions = []interface{}{map[string]interface{}{"name": v}}
+	}
+
+	for _, v := range versions {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		version, _, _ := unstructured.NestedString(m, "name")
+		schema, ok, _ := unstructured.NestedMap(m, "schema", "openAPIV3Schema")
+		if !ok {
+			schema = common
+		}
+		if version == "" || schema == nil {
+			continue
+		}
+
+		b, err := json.Marshal(strictSchema(schema, true))
+		if err != nil {
+			return err
+		}
+		u := crdSchemaURL + group + "/" + kind + "_" + version + ".json"
+		// a CRD in the job replaces a CRD from CRDDir.
+		delete(l.schemas, u)
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft4
+		err = c.AddResource(u, bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("crd %s: %w", crd.GetName(), err)
+		}
+		s, err := c.Compile(u)
+		if err != nil {
+			return fmt.Errorf("crd %s: %w", crd.GetName(), err)
+		}
+		l.schemas[u] = s
+		l.crds[gvkKey(group, version, kind)] = u
+	}
+
+	return nil
+}
+
+// StrictSchema returns a JSON schema for the OpenAPI v3 schema s of a CRD.
+// Objects with properties don't allow additional properties (unless x-kubernetes-preserve-unknown-fields is set) and
+// the Kubernetes extensions for int-or-string and nullable are turned into JSON schema types.
+// Root is true for the schema of the resource itself.
+func strictSchema(s map[string]interface{}, root bool) map[string]interface{} {
+	r := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			switch k {
+			case "properties", "patternProperties", "definitions":
+				ps := make(map[string]interface{}, len(vv))
+				for n, p := range vv {
+					if pm, ok := p.(map[string]interface{}); ok {
+						ps[n] = strictSchema(pm, false)
+					} else {
+						ps[n] = p
+					}
+				}
+				r[k] = ps
+			default:
+				r[k] = strictSchema(vv, false)
+			}
+		case []interface{}:
+			items := make([]interface{}, len(vv))
+			for i, it := range vv {
+				if m, ok := it.(map[string]interface{}); ok {
+					items[i] = strictSchema(m, false)
+				} else {
+					items[i] = it
+				}
+			}
+			r[k] = items
+		default:
+			r[k] = v
+		}
+	}
+
+	if b, _ := s["x-kubernetes-int-or-string"].(bool); b {
+		delete(r, "type")
+		r["type"] = []interface{}{"integer", "string"}
+	}
+	if b, _ := s["nullable"].(bool); b {
+		if t, ok := r["type"].(string); ok {
+			r["type"] = []interface{}{t, "null"}
+		}
+	}
+
+	if root {
+		ps, _ := r["properties"].(map[string]interface{})
+		if ps == nil {
+			ps = map[string]interface{}{}
+			r["properties"] = ps
+		}
+		for _, n := range []string{"apiVersion", "kind"} {
+			if _, ok := ps[n]; !ok {
+				ps[n] = map[string]interface{}{"type": "string"}
+			}
+		}
+		if _, ok := ps["metadata"]; !ok {
+			ps["metadata"] = map[string]interface{}{"type": "object"}
+		}
+	}
+
+	_, hasProps := r["properties"]
+	_, hasAdditional := r["additionalProperties"]
+	preserve, _ := s["x-kubernetes-preserve-unknown-fields"].(bool)
+	embedded, _ := s["x-kubernetes-embedded-resource"].(bool)
+	if hasProps && !hasAdditional && !preserve && !embedded {
+		r["additionalProperties"] = false
+	}
+
+	return r
+}
+
+// ValidationErrors returns the leaf errors of err in sorted order as text like "/spec/replicas: expected integer, but got string".
+func validationErrors(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return []string{err.Error()}
+	}
+
+	var r []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			loc := e.InstanceLocation
+			if loc == "" {
+				loc = "/"
+			}
+			r = append(r, loc+": "+e.Message)
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+	sort.Strings(r)
+	return r
+}
+
+// GvkKey returns the key of group, version, kind in maps.
+func gvkKey(group, version, kind string) string {
+	return group + "/" + version + "/" + kind
+}
+
+// IsYamlFile returns true when name has a yaml or json extension.
+func isYamlFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
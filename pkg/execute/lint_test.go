@@ -0,0 +1,192 @@
+package execute
+
+import (
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecute_lint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	err = os.MkdirAll(filepath.Join(dir, "v1.20.0-standalone-strict"), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "v1.20.0-standalone-strict", "configmap-v1.json"), []byte(`{
+  "type": "object",
+  "properties": {
+    "apiVersion": {"type": "string"},
+    "kind": {"type": "string"},
+    "metadata": {"type": "object"},
+    "data": {"type": "object", "additionalProperties": {"type": "string"}}
+  },
+  "additionalProperties": false
+}`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "v1.20.0-standalone-strict", "customresourcedefinition-apiextensions-v1.json"),
+		[]byte(`{"type": "object"}`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const crd = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+spec:
+  group: example.com
+  names:
+    kind: Example
+    plural: examples
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              replicas:
+                type: integer
+              port:
+                x-kubernetes-int-or-string: true
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+	tests := []struct {
+		it      string
+		docs    []string
+		wantErr string
+	}{
+		{
+			it: "should_accept_valid_objects",
+			docs: []string{`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+data:
+  k: v
+`, crd, `apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+spec:
+  replicas: 1
+  port: http
+  extra:
+    anything: goes
+`},
+		},
+		{
+			it: "should_report_errors_with_their_location",
+			docs: []string{`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+dta:
+  k: v
+---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+`, crd + `---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+spec:
+  replicas: "1"
+  replica: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: old
+`},
+			wantErr: `lint: 7 errors:
+ID       TPL  ISSUE
+##01.01  tpl  /: additionalProperties 'dta' not allowed
+##01.02  tpl  no schema for kind example.com/v1 Example
+##02.02  tpl  /spec/replicas: expected integer, but got string
+##02.02  tpl  /spec: additionalProperties 'replica' not allowed
+##02.03  tpl  no schema for kind apps/v1 Deployment
+##02.04  tpl  extensions/v1beta1 Deployment is removed in 1.16, use apps/v1
+##02.04  tpl  no schema for kind extensions/v1beta1 Deployment
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{
+				SchemaDir:         dir,
+				KubernetesVersion: "1.20.0",
+				Log:               logrtesting.TestLogger{T: t},
+			}
+
+			err := x.BeginLint()
+			if !assert.NoError(t, err) {
+				return
+			}
+			for i, doc := range tt.docs {
+				_, err = x.Apply(i+1, "tpl", ApplyOpt{}, []byte(doc))
+				assert.NoError(t, err)
+			}
+			err = x.EndLint()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_schemaPaths(t *testing.T) {
+	tests := []struct {
+		it                   string
+		version              string
+		group, gvVersion, kd string
+		want                 []string
+	}{
+		{
+			it:        "should_return_core_kind_path",
+			version:   "1.20.0",
+			gvVersion: "v1", kd: "ConfigMap",
+			want: []string{"d/v1.20.0-standalone-strict/configmap-v1.json", "d/v1.20.0-standalone/configmap-v1.json"},
+		},
+		{
+			it:    "should_return_group_kind_and_crd_paths",
+			group: "networking.k8s.io", gvVersion: "v1", kd: "Ingress",
+			want: []string{"d/master-standalone-strict/ingress-networking-v1.json", "d/master-standalone/ingress-networking-v1.json",
+				"d/networking.k8s.io/ingress_v1.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := schemaPaths("d", tt.version, tt.group, tt.gvVersion, tt.kd)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package execute
+
+import (
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InjectNamespace sets the namespace of o to opt.Namespace when o is a namespaced object without namespace.
+// When opt.SubjectNamespaces is set the ServiceAccount subjects without namespace of a RoleBinding get the namespace
+// of the RoleBinding and those of a ClusterRoleBinding get opt.Namespace.
+// Discovery and the CRDs in the job tell which kinds are namespaced.
+func (x *Execute) injectNamespace(o object, opt ApplyOpt) (object, error) {
+	obj, err := decodeObject(o.doc)
+	if err != nil {
+		return o, err
+	}
+	gvk := metav1.GroupVersionKind(obj.GroupVersionKind())
+
+	if gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition" {
+		x.jobKinds = append(x.jobKinds, crdResources(obj)...)
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespaced, err := x.isNamespaced(gvk)
+		if err != nil {
+			return o, err
+		}
+		if namespaced {
+			o.doc, err = yamlx.SetNamespace(o.doc, opt.Namespace)
+			if err != nil {
+				return o, err
+			}
+			namespace = opt.Namespace
+		}
+	}
+
+	if opt.SubjectNamespaces && gvk.Group == "rbac.authorization.k8s.io" {
+		switch gvk.Kind {
+		case "RoleBinding":
+		case "ClusterRoleBinding":
+			namespace = opt.Namespace
+		default:
+			return o, nil
+		}
+		o.doc, err = yamlx.SetSubjectNamespaces(o.doc, namespace)
+		if err != nil {
+			return o, err
+		}
+	}
+
+	return o, nil
+}
+
+// IsNamespaced returns true when gvk is a namespaced kind according to discovery or the CRDs in the job.
+// Discovery is refreshed once when gvk is unknown because its CRD might have been applied after discovery.
+func (x *Execute) isNamespaced(gvk metav1.GroupVersionKind) (bool, error) {
+	if r, ok := apiResource(gvk, x.jobKinds); ok {
+		return r.Namespaced, nil
+	}
+	resources, err := x.getK8sAPIResources()
+	if err != nil {
+		return false, err
+	}
+	if r, ok := apiResource(gvk, resources); ok {
+		return r.Namespaced, nil
+	}
+
+	x.discovered = nil
+	resources, err = x.getK8sAPIResources()
+	if err != nil {
+		return false, err
+	}
+	if r, ok := apiResource(gvk, resources); ok {
+		return r.Namespaced, nil
+	}
+
+	return false, fmt.Errorf("can't tell if %s is namespaced; kind is not served by the cluster or created by a CRD in the job", gvkString(gvk))
+}
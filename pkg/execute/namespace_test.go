@@ -0,0 +1,167 @@
+package execute
+
+import (
+	"bytes"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestExecute_Apply_namespace(t *testing.T) {
+	tests := []struct {
+		it   string
+		opt  ApplyOpt
+		in   string
+		want string
+	}{
+		{
+			it:  "should_set_namespace_of_namespaced_objects_only",
+			opt: ApplyOpt{Namespace: "ns"},
+			in: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: other
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cr
+`,
+			want: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: ns
+---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: other
+---
+##01.03: InstrApply [apply -f -] tpl
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cr
+
+`,
+		},
+		{
+			it:  "should_set_namespace_of_custom_resources_of_crds_in_the_job",
+			opt: ApplyOpt{Namespace: "ns"},
+			in: `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+spec:
+  group: example.com
+  names:
+    kind: Example
+    plural: examples
+  scope: Namespaced
+---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+`,
+			want: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+spec:
+  group: example.com
+  names:
+    kind: Example
+    plural: examples
+  scope: Namespaced
+---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+  namespace: ns
+
+`,
+		},
+		{
+			it:  "should_set_namespace_of_subjects",
+			opt: ApplyOpt{Namespace: "ns", SubjectNamespaces: true},
+			in: `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: rb
+  namespace: rbns
+subjects:
+- kind: ServiceAccount
+  name: sa
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: crb
+subjects:
+- kind: ServiceAccount
+  name: sa
+`,
+			want: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: rb
+  namespace: rbns
+subjects:
+- kind: ServiceAccount
+  namespace: rbns
+  name: sa
+---
+##01.02: InstrApply [apply -f -] tpl
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: crb
+subjects:
+- kind: ServiceAccount
+  namespace: ns
+  name: sa
+
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var out bytes.Buffer
+			x := &Execute{
+				Out: &out,
+				Log: logrtesting.TestLogger{T: t},
+				discovered: &discovery{resources: []metav1.APIResource{
+					{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+					{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition", Name: "customresourcedefinitions"},
+					{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Name: "clusterroles"},
+					{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding", Name: "clusterrolebindings"},
+					{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding", Name: "rolebindings", Namespaced: true},
+				}},
+			}
+
+			_, err := x.Apply(1, "tpl", tt.opt, []byte(tt.in))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, out.String())
+			}
+		})
+	}
+}
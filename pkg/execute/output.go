@@ -0,0 +1,205 @@
+package execute
+
+import (
+	"fmt"
+	yaml2 "gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IndexFile is the name of the file in OutputDir that lists the generated steps in order.
+const IndexFile = "index.yaml"
+
+// Output writes the generated steps to a directory tree instead of Out, see BeginGenerate.
+type output struct {
+	// dir is the root of the tree.
+	dir string
+	// index lists the steps written so far.
+	index outputIndex
+}
+
+// OutputIndex is the content of IndexFile.
+type outputIndex struct {
+	Steps []outputStep `yaml:"steps"`
+}
+
+// OutputStep describes a generated step.
+type outputStep struct {
+	// ID of the step.
+	ID int `yaml:"id"`
+	// Type of step; tmplt, wait or action.
+	Type string `yaml:"type"`
+	// Template is the name of the template (tmplt and action only).
+	Template string `yaml:"template,omitempty"`
+	// Args are the kubectl arguments to apply the files or wait for a condition.
+	Args []string `yaml:"args,omitempty"`
+	// PortForward are the 'kubectl port-forward' flags of an action.
+	PortForward string `yaml:"portForward,omitempty"`
+	// Dir is the directory (relative to the output dir) with the files of the step.
+	Dir string `yaml:"dir,omitempty"`
+	// Files in Dir in the order they are applied.
+	Files []string `yaml:"files,omitempty"`
+}
+
+// BeginGenerate makes subsequent Apply, Wait and Action calls write to OutputDir instead of Out.
+// Each step gets a NN-<template> directory with a <kind>-<namespace>-<name>.yaml file per object, IndexFile
+// lists the steps in order (see EndGenerate).
+// The step directories of a previous run (as listed in its IndexFile) are removed so the tree only contains the
+// objects of this run. BeginGenerate does nothing when OutputDir isn't set.
+func (x *Execute) BeginGenerate() error {
+	if x.OutputDir == "" {
+		return nil
+	}
+	err := cleanOutputDir(x.OutputDir)
+	if err != nil {
+		return err
+	}
+	x.output = &output{dir: x.OutputDir}
+	return nil
+}
+
+// EndGenerate writes the IndexFile of the steps generated since BeginGenerate or the instructions of
+// OutputFormatJSON.
+func (x *Execute) EndGenerate() error {
+	err := x.writeInstructions()
+	if err != nil {
+		return err
+	}
+
+	o := x.output
+	x.output = nil
+	if o == nil {
+		return nil
+	}
+	b, err := yaml2.Marshal(o.index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(o.dir, IndexFile), b, 0644)
+}
+
+// CleanOutputDir prepares dir for a new tree by removing the files listed in the IndexFile of a previous run.
+// Dir is created when it doesn't exist, it's an error when dir has other content but no IndexFile.
+func cleanOutputDir(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("output dir: %w", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if os.IsNotExist(err) {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("output dir: %w", err)
+		}
+		if len(fis) > 0 {
+			return fmt.Errorf("output dir %s is not empty and has no %s", dir, IndexFile)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("output dir: %w", err)
+	}
+
+	var index outputIndex
+	err = yaml2.Unmarshal(b, &index)
+	if err != nil {
+		return fmt.Errorf("output dir %s: %s: %w", dir, IndexFile, err)
+	}
+	for _, s := range index.Steps {
+		if s.Dir == "" {
+			continue
+		}
+		if !stepDirName.MatchString(s.Dir) {
+			return fmt.Errorf("output dir %s: %s: unexpected step dir: %s", dir, IndexFile, s.Dir)
+		}
+		err = os.RemoveAll(filepath.Join(dir, s.Dir))
+		if err != nil {
+			return fmt.Errorf("output dir: %w", err)
+		}
+	}
+
+	return os.Remove(filepath.Join(dir, IndexFile))
+}
+
+// Apply writes objects to the directory of step id.
+func (o *output) apply(id int, name string, args []string, objects []object) error {
+	s := outputStep{ID: id, Type: "tmplt", Template: name, Args: args, Dir: stepDir(id, name)}
+
+	files := map[string]bool{}
+	for _, obj := range objects {
+		f := objectFile(obj)
+		if files[f] {
+			return fmt.Errorf("##%s tpl %s: output file %s/%s already exists", obj.ID(), name, s.Dir, f)
+		}
+		files[f] = true
+		err := o.write(s.Dir, f, obj.doc)
+		if err != nil {
+			return err
+		}
+		s.Files = append(s.Files, f)
+	}
+
+	o.index.Steps = append(o.index.Steps, s)
+	return nil
+}
+
+// Wait adds a wait step to the index.
+func (o *output) wait(id int, args []string) {
+	o.index.Steps = append(o.index.Steps, outputStep{ID: id, Type: "wait", Args: args})
+}
+
+// Action writes the action doc to the directory of step id.
+func (o *output) action(id int, name string, portForward string, doc []byte) error {
+	s := outputStep{ID: id, Type: "action", Template: name, PortForward: portForward, Dir: stepDir(id, name),
+		Files: []string{"action.yaml"}}
+	err := o.write(s.Dir, s.Files[0], doc)
+	if err != nil {
+		return err
+	}
+	o.index.Steps = append(o.index.Steps, s)
+	return nil
+}
+
+// Write writes doc to file in dir (relative to the output dir).
+func (o *output) write(dir, file string, doc []byte) error {
+	p := filepath.Join(o.dir, dir)
+	err := os.MkdirAll(p, 0755)
+	if err != nil {
+		return fmt.Errorf("output dir: %w", err)
+	}
+	if len(doc) > 0 && doc[len(doc)-1] != '\n' {
+		doc = append(doc[:len(doc):len(doc)], '\n')
+	}
+	return ioutil.WriteFile(filepath.Join(p, file), doc, 0644)
+}
+
+// StepDir returns the directory name of step id with template name like 01-app (for app.yaml).
+func stepDir(id int, name string) string {
+	return fmt.Sprintf("%02d-%s", id, safeFileName(strings.TrimSuffix(name, filepath.Ext(name))))
+}
+
+// ObjectFile returns the file name of o like deployment.apps-default-app.yaml, see objectFilename.
+// Documents that aren't Kubernetes objects are named after their id like 01.02.yaml.
+func objectFile(o object) string {
+	obj, err := decodeObject(o.doc)
+	if err != nil || obj.GetKind() == "" || obj.GetName() == "" {
+		return o.ID() + ".yaml"
+	}
+	return safeFileName(objectFilename(obj.GroupVersionKind().Group, obj.GetKind(), obj.GetNamespace(), obj.GetName()))
+}
+
+// StepDirName matches the names returned by stepDir.
+var stepDirName = regexp.MustCompile(`^[0-9]+-[a-zA-Z0-9._-]*$`)
+
+// UnsafeFileChars matches the characters that are replaced by safeFileName.
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// SafeFileName returns s with characters that are troublesome in file names (like the : in system:admin) replaced
+// by _
+func safeFileName(s string) string {
+	return unsafeFileChars.ReplaceAllString(s, "_")
+}
@@ -0,0 +1,132 @@
+package execute
+
+import (
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecute_generate_outputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	x := &Execute{OutputDir: dir, Log: logrtesting.TestLogger{T: t}}
+
+	// first run.
+	err = x.BeginGenerate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = x.Apply(1, "app.yaml", ApplyOpt{}, []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: system:reader
+  namespace: ns
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, x.Wait(2, "--for condition=available deploy/app"))
+	assert.NoError(t, x.Action(3, "secret.yaml", []byte("type: getSecret\n"), "", nil))
+	_, err = x.Apply(4, "old.yaml", ApplyOpt{}, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, x.EndGenerate()) {
+		return
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if assert.NoError(t, err) {
+		assert.Equal(t, `steps:
+- id: 1
+  type: tmplt
+  template: app.yaml
+  args:
+  - apply
+  - -f
+  - '-'
+  dir: 01-app
+  files:
+  - namespace-ns.yaml
+  - role.rbac.authorization.k8s.io-ns-system_reader.yaml
+- id: 2
+  type: wait
+  args:
+  - wait
+  - --for
+  - condition=available
+  - deploy/app
+- id: 3
+  type: action
+  template: secret.yaml
+  dir: 03-secret
+  files:
+  - action.yaml
+- id: 4
+  type: tmplt
+  template: old.yaml
+  args:
+  - apply
+  - -f
+  - '-'
+  dir: 04-old
+  files:
+  - configmap-cm.yaml
+`, string(b))
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "01-app", "namespace-ns.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n", string(b))
+	}
+
+	// second run removes the steps of the first run.
+	err = x.BeginGenerate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = x.Apply(1, "app.yaml", ApplyOpt{}, []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, x.EndGenerate()) {
+		return
+	}
+	_, err = os.Stat(filepath.Join(dir, "04-old"))
+	assert.True(t, os.IsNotExist(err), "stale step dir is removed")
+	_, err = os.Stat(filepath.Join(dir, "01-app", "role.rbac.authorization.k8s.io-ns-system_reader.yaml"))
+	assert.True(t, os.IsNotExist(err), "stale object file is removed")
+}
+
+func Test_cleanOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("keep"), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = cleanOutputDir(dir)
+	assert.EqualError(t, err, "output dir "+dir+" is not empty and has no index.yaml")
+
+	err = ioutil.WriteFile(filepath.Join(dir, IndexFile), []byte("steps:\n- id: 1\n  dir: .\n"), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = cleanOutputDir(dir)
+	assert.EqualError(t, err, "output dir "+dir+": index.yaml: unexpected step dir: .")
+}
@@ -0,0 +1,112 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+)
+
+// Annotations used on deployed objects.
+const (
+	// OwnerAnnotation is set to the namespace/name of the store that owns the object.
+	OwnerAnnotation = "deploy.mmlt.nl/owner"
+	// PruneAnnotation set to "false" prevents the object from being pruned.
+	PruneAnnotation = "deploy.mmlt.nl/prune"
+	// TimeAnnotation is set to the time of deployment (RFC3339).
+	TimeAnnotation = "deploy.mmlt.nl/time"
+	// JobFileAnnotation is set to the path of the job file.
+	JobFileAnnotation = "deploy.mmlt.nl/job-file"
+	// GitCommitAnnotation is set to the git commit of the repo that contains the job file.
+	GitCommitAnnotation = "deploy.mmlt.nl/git-commit"
+	// VersionAnnotation is set to the version of the tool.
+	VersionAnnotation = "deploy.mmlt.nl/version"
+)
+
+// StoreOwner returns the value of the OwnerAnnotation for objects deployed by the job that uses store.
+func StoreOwner(store Store) string {
+	return store.Namespace + "/" + store.Name
+}
+
+// CheckOwner returns an error when the live object of doc is owned by another store than owner.
+func (x *Execute) checkOwner(doc []byte, owner string) error {
+	args := []string{"get", "-f", "-", "--ignore-not-found", "-o", "json"}
+	stdout, _, err := x.Kubectl.Run(nil, string(doc), args...)
+	if err != nil {
+		if isUnknownKind(err) {
+			// the kind isn't served (yet) so there is no live object.
+			return nil
+		}
+		return fmt.Errorf("get owner: %w", err)
+	}
+
+	obj, err := decodeLiveObject(stdout)
+	if err != nil || obj == nil {
+		return err
+	}
+
+	o := obj.GetAnnotations()[OwnerAnnotation]
+	if o != "" && o != owner {
+		return fmt.Errorf("object is owned by store %s (use --adopt to take ownership)", o)
+	}
+
+	return nil
+}
+
+// PruneProtection returns a reason when the live object obj must not be deleted.
+// Objects that don't exist anymore (nil), objects annotated with deploy.mmlt.nl/prune=false and objects that are owned
+// by another store than owner are protected.
+func pruneProtection(obj *unstructured.Unstructured, owner string) string {
+	if obj == nil {
+		return "not found"
+	}
+
+	a := obj.GetAnnotations()
+	if a[PruneAnnotation] == "false" {
+		return PruneAnnotation + "=false"
+	}
+	if o := a[OwnerAnnotation]; o != "" && o != owner {
+		return "owned by store " + o
+	}
+
+	return ""
+}
+
+// GetLive returns the live object r (with resource name rn) or nil when it doesn't exist.
+func (x *Execute) getLive(rn string, r KindNamespaceName) (*unstructured.Unstructured, error) {
+	args := []string{"get", rn, r.Name, "--ignore-not-found", "-o", "json"}
+	if r.Namespace != "" {
+		args = append(args, "-n", r.Namespace)
+	}
+	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", rn, err)
+	}
+
+	obj, err := decodeLiveObject(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", rn, err)
+	}
+
+	return obj, nil
+}
+
+// DecodeLiveObject decodes the kubectl get -o json output of a single object.
+// It returns nil when s is empty (object not found).
+func decodeLiveObject(s string) (*unstructured.Unstructured, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	obj := &unstructured.Unstructured{}
+	err := json.Unmarshal([]byte(s), &obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// IsUnknownKind returns true when err is a kubectl error about a kind that isn't served by the cluster.
+func isUnknownKind(err error) bool {
+	s := err.Error()
+	return strings.Contains(s, "no matches for kind") || strings.Contains(s, "the server doesn't have a resource type")
+}
@@ -0,0 +1,94 @@
+package execute
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecute_checkOwner(t *testing.T) {
+	tests := []struct {
+		it      string
+		fake    fakeKubectl
+		wantErr string
+	}{
+		{
+			it:   "should_accept_object_that_does_not_exist",
+			fake: fakeKubectl{stdout: ""},
+		},
+		{
+			it:   "should_accept_object_of_unknown_kind",
+			fake: fakeKubectl{err: fmt.Errorf(`error: unable to recognize "STDIN": no matches for kind "X" in version "v1"`)},
+		},
+		{
+			it:   "should_accept_object_without_owner",
+			fake: fakeKubectl{stdout: liveObject(nil)},
+		},
+		{
+			it:   "should_accept_object_with_same_owner",
+			fake: fakeKubectl{stdout: liveObject(map[string]string{OwnerAnnotation: "default/me"})},
+		},
+		{
+			it:      "should_reject_object_with_other_owner",
+			fake:    fakeKubectl{stdout: liveObject(map[string]string{OwnerAnnotation: "default/other"})},
+			wantErr: "object is owned by store default/other (use --adopt to take ownership)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{Kubectl: tt.fake}
+			err := x.checkOwner([]byte("kind: ConfigMap"), "default/me")
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_pruneProtection(t *testing.T) {
+	tests := []struct {
+		it   string
+		live string
+		want string
+	}{
+		{
+			it:   "should_protect_object_that_does_not_exist",
+			live: "",
+			want: "not found",
+		},
+		{
+			it:   "should_protect_object_with_prune_false_annotation",
+			live: liveObject(map[string]string{PruneAnnotation: "false"}),
+			want: "deploy.mmlt.nl/prune=false",
+		},
+		{
+			it:   "should_protect_object_with_other_owner",
+			live: liveObject(map[string]string{OwnerAnnotation: "default/other"}),
+			want: "owned by store default/other",
+		},
+		{
+			it:   "should_not_protect_owned_object",
+			live: liveObject(map[string]string{OwnerAnnotation: "default/me"}),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			obj, err := decodeLiveObject(tt.live)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, pruneProtection(obj, "default/me"))
+			}
+		})
+	}
+}
+
+// LiveObject returns a ConfigMap in kubectl get -o json format.
+func liveObject(annotations map[string]string) string {
+	a := ""
+	for k, v := range annotations {
+		a = fmt.Sprintf(`,"annotations":{%q:%q}`, k, v)
+	}
+	return fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns"%s}}`, a)
+}
@@ -0,0 +1,226 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	jsonpatch "github.com/evanphx/json-patch"
+	yaml2 "gopkg.in/yaml.v2"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+	"sort"
+)
+
+// Patch modifies the rendered objects that are selected by Target.
+// Exactly one of Patch and JSONPatch must be set.
+type Patch struct {
+	// Target selects the objects to patch.
+	Target PatchTarget `yaml:"target"`
+	// Patch is a strategic merge patch (a yaml mapping or text).
+	// Kinds of groups without strategic merge information (like custom resources) are patched with a JSON merge patch
+	// (RFC 7386), built-in kinds at a version without strategic merge information are an error.
+	Patch interface{} `yaml:"patch"`
+	// JSONPatch is a JSON patch (RFC 6902); a list of operations (or text) like '- {op: replace, path: /a, value: 1}'
+	JSONPatch interface{} `yaml:"jsonPatch"`
+}
+
+// PatchTarget selects objects, empty fields match any object.
+type PatchTarget struct {
+	Group     string            `yaml:"group"`
+	Version   string            `yaml:"version"`
+	Kind      string            `yaml:"kind"`
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+// PatchScheme knows the Kubernetes types that support strategic merge patches.
+var patchScheme = newPatchScheme()
+
+// NewPatchScheme returns a scheme with the Kubernetes API types that are commonly used in templates.
+func newPatchScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		admissionregistrationv1.AddToScheme,
+		appsv1.AddToScheme,
+		autoscalingv1.AddToScheme,
+		autoscalingv2beta2.AddToScheme,
+		batchv1.AddToScheme,
+		batchv1beta1.AddToScheme,
+		corev1.AddToScheme,
+		networkingv1.AddToScheme,
+		networkingv1beta1.AddToScheme,
+		policyv1beta1.AddToScheme,
+		rbacv1.AddToScheme,
+		schedulingv1.AddToScheme,
+		storagev1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// ApplyPatches applies the patches of template name to the objects they select.
+// Patched objects are re-encoded (key order and comments are not kept).
+// It's an error when a patch doesn't set exactly one of patch and jsonPatch or doesn't select any object.
+func applyPatches(name string, objects []object, patches []Patch) ([]object, error) {
+	for i, p := range patches {
+		if (p.Patch == nil) == (p.JSONPatch == nil) {
+			return nil, fmt.Errorf("tpl %s patch %d: set either patch or jsonPatch", name, i+1)
+		}
+		var patch []byte
+		var jp jsonpatch.Patch
+		var err error
+		if p.Patch != nil {
+			patch, err = patchJSON(p.Patch)
+		} else {
+			patch, err = patchJSON(p.JSONPatch)
+			if err == nil {
+				jp, err = jsonpatch.DecodePatch(patch)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tpl %s patch %d: %w", name, i+1, err)
+		}
+
+		matched := false
+		for j, o := range objects {
+			obj, err := decodeObject(o.doc)
+			if err != nil {
+				return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
+			gvk := obj.GroupVersionKind()
+			if !p.Target.selects(gvk.Group, gvk.Version, gvk.Kind, obj.GetName(), obj.GetNamespace(), obj.GetLabels()) {
+				continue
+			}
+			matched = true
+
+			doc, err := yaml.YAMLToJSON(o.doc)
+			if err != nil {
+				return nil, fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+			}
+			if p.Patch != nil {
+				dataStruct, err := patchScheme.New(gvk)
+				switch {
+				case err == nil:
+					doc, err = strategicpatch.StrategicMergePatch(doc, patch, dataStruct)
+				case runtime.IsNotRegisteredError(err) && patchScheme.IsGroupRegistered(gvk.Group):
+					// a built-in kind at a version without strategic merge information, a JSON merge patch would
+					// replace lists instead of merging them.
+					err = fmt.Errorf("no strategic merge information for %s, use jsonPatch instead", gvkString(metav1.GroupVersionKind(gvk)))
+				case runtime.IsNotRegisteredError(err):
+					doc, err = jsonpatch.MergePatch(doc, patch)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("##%s tpl %s patch %d: %w", o.ID(), name, i+1, err)
+				}
+			} else {
+				doc, err = jp.Apply(doc)
+				if err != nil {
+					return nil, fmt.Errorf("##%s tpl %s patch %d: %w", o.ID(), name, i+1, err)
+				}
+			}
+
+			objects[j].doc, err = yaml.JSONToYAML(doc)
+			if err != nil {
+				return nil, fmt.Errorf("##%s tpl %s patch %d: %w", o.ID(), name, i+1, err)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("tpl %s patch %d: no object matches target %s", name, i+1, p.Target)
+		}
+	}
+
+	return objects, nil
+}
+
+// Selects returns true when an object with the given fields is selected by t.
+func (t PatchTarget) selects(group, version, kind, name, namespace string, labels map[string]string) bool {
+	if t.Group != "" && t.Group != group || t.Version != "" && t.Version != version || t.Kind != "" && t.Kind != kind ||
+		t.Name != "" && t.Name != name || t.Namespace != "" && t.Namespace != namespace {
+		return false
+	}
+	for k, v := range t.Labels {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns t as text like 'kind=Deployment name=app'.
+func (t PatchTarget) String() string {
+	var s string
+	for _, f := range []struct{ k, v string }{
+		{"group", t.Group}, {"version", t.Version}, {"kind", t.Kind}, {"name", t.Name}, {"namespace", t.Namespace},
+	} {
+		if f.v != "" {
+			s += fmt.Sprintf(" %s=%s", f.k, f.v)
+		}
+	}
+	var keys []string
+	for k := range t.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s += fmt.Sprintf(" labels.%s=%s", k, t.Labels[k])
+	}
+	if s == "" {
+		return "(any)"
+	}
+	return s[1:]
+}
+
+// PatchJSON returns the JSON of patch v, v is a decoded yaml value or yaml text.
+func patchJSON(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		err := yaml2.Unmarshal([]byte(s), &v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(jsonValue(v))
+}
+
+// JsonValue returns v with the map[interface{}]interface{} values that yaml.v2 decodes turned into
+// map[string]interface{} so v can be marshalled to JSON.
+func jsonValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, x := range vv {
+			m[fmt.Sprint(k)] = jsonValue(x)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, x := range vv {
+			m[k] = jsonValue(x)
+		}
+		return m
+	case []interface{}:
+		r := make([]interface{}, len(vv))
+		for i, x := range vv {
+			r[i] = jsonValue(x)
+		}
+		return r
+	}
+	return v
+}
@@ -0,0 +1,179 @@
+package execute
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_applyPatches(t *testing.T) {
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1
+      - name: sidecar
+        image: sidecar:1
+`
+	example := `apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: ex
+spec:
+  list:
+  - a
+`
+
+	tests := []struct {
+		it      string
+		in      []string
+		patches []Patch
+		want    []string
+		wantErr string
+	}{
+		{
+			it: "should_strategic_merge_containers_by_name",
+			in: []string{deployment},
+			patches: []Patch{{
+				Target: PatchTarget{Kind: "Deployment", Name: "app"},
+				Patch: map[interface{}]interface{}{
+					"spec": map[interface{}]interface{}{
+						"replicas": 3,
+						"template": map[interface{}]interface{}{
+							"spec": map[interface{}]interface{}{
+								"containers": []interface{}{
+									map[interface{}]interface{}{"name": "sidecar", "image": "sidecar:2"},
+								},
+							},
+						},
+					},
+				},
+			}},
+			want: []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: web
+  name: app
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - image: app:1
+        name: app
+      - image: sidecar:2
+        name: sidecar
+`},
+		},
+		{
+			it: "should_apply_json_patch_to_objects_selected_by_labels",
+			in: []string{deployment, example},
+			patches: []Patch{{
+				Target:    PatchTarget{Labels: map[string]string{"app": "web"}},
+				JSONPatch: "- {op: replace, path: /spec/replicas, value: 2}",
+			}},
+			want: []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: web
+  name: app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - image: app:1
+        name: app
+      - image: sidecar:1
+        name: sidecar
+`, example},
+		},
+		{
+			it: "should_merge_patch_custom_resources",
+			in: []string{example},
+			patches: []Patch{{
+				Target: PatchTarget{Group: "example.com", Kind: "Example"},
+				Patch:  "spec:\n  list:\n  - b\n",
+			}},
+			want: []string{`apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: ex
+spec:
+  list:
+  - b
+`},
+		},
+		{
+			it: "should_error_when_a_patch_selects_no_object",
+			in: []string{example},
+			patches: []Patch{{
+				Target: PatchTarget{Kind: "Deployment", Labels: map[string]string{"app": "web"}},
+				Patch:  "spec: {}",
+			}},
+			wantErr: "tpl tpl patch 1: no object matches target kind=Deployment labels.app=web",
+		},
+		{
+			it: "should_error_on_strategic_merge_of_built_in_kind_at_unknown_version",
+			in: []string{"apiVersion: apps/v1beta2\nkind: Deployment\nmetadata:\n  name: app\n"},
+			patches: []Patch{{
+				Target: PatchTarget{Kind: "Deployment"},
+				Patch:  "spec: {replicas: 2}",
+			}},
+			wantErr: "##01.01 tpl tpl patch 1: no strategic merge information for apps/v1beta2 Deployment, use jsonPatch instead",
+		},
+		{
+			it: "should_error_when_patch_and_json_patch_are_set",
+			in: []string{example},
+			patches: []Patch{{
+				Patch:     "spec: {}",
+				JSONPatch: "[]",
+			}},
+			wantErr: "tpl tpl patch 1: set either patch or jsonPatch",
+		},
+		{
+			it:      "should_error_when_patch_and_json_patch_are_missing",
+			in:      []string{example},
+			patches: []Patch{{Target: PatchTarget{Kind: "Example"}}},
+			wantErr: "tpl tpl patch 1: set either patch or jsonPatch",
+		},
+		{
+			it: "should_error_with_object_id_when_json_patch_fails",
+			in: []string{example},
+			patches: []Patch{{
+				JSONPatch: "- {op: remove, path: /spec/missing}",
+			}},
+			wantErr: "##01.01 tpl tpl patch 1: error in remove for path: '/spec/missing': Unable to remove nonexistent key: missing: missing value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var objects []object
+			for i, s := range tt.in {
+				objects = append(objects, object{id: 1, sub: i + 1, doc: []byte(s)})
+			}
+			got, err := applyPatches("tpl", objects, tt.patches)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			var docs []string
+			for _, o := range got {
+				docs = append(docs, string(o.doc))
+			}
+			assert.Equal(t, tt.want, docs)
+		})
+	}
+}
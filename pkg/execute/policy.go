@@ -0,0 +1,39 @@
+package execute
+
+import (
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/policy"
+)
+
+// CheckPolicy evaluates pol against objects.
+// Violated warn rules are logged, violated deny rules are returned as an error with a table of violations.
+// When linting or preflighting the deny violations are recorded as issues so all steps are checked.
+func (x *Execute) checkPolicy(name string, pol *policy.Policy, objects []object) error {
+	var denied []issue
+	for _, o := range objects {
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+		}
+		for _, v := range pol.Evaluate(obj.Object) {
+			text := fmt.Sprintf("policy %s: %s", v.Rule, v.Message)
+			if v.Severity == policy.SeverityWarn {
+				x.log("policy WARNING", o.id, o.sub, name, text)
+				continue
+			}
+			denied = append(denied, issue{id: o.ID(), tpl: name, text: text})
+		}
+	}
+
+	switch {
+	case len(denied) == 0:
+		return nil
+	case x.lint != nil:
+		x.lint.issues = append(x.lint.issues, denied...)
+		return nil
+	case x.preflight != nil:
+		x.preflight.issues = append(x.preflight.issues, denied...)
+		return nil
+	}
+	return fmt.Errorf("tpl %s: policy violations:\n%s", name, issuesTable(denied))
+}
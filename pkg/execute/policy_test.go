@@ -0,0 +1,77 @@
+package execute
+
+import (
+	"bytes"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/mmlt/kubectl-tmplt/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecute_Apply_policy(t *testing.T) {
+	const docs = `apiVersion: v1
+kind: Pod
+metadata:
+  name: a
+spec:
+  containers:
+  - image: nginx:latest
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: b
+  annotations:
+    deploy.mmlt.nl/policy-exempt: no-latest-tag
+spec:
+  containers:
+  - image: nginx:latest
+`
+	tests := []struct {
+		it       string
+		severity string
+		wantErr  string
+	}{
+		{
+			it:       "should_fail_on_deny_violations",
+			severity: policy.SeverityDeny,
+			wantErr: `tpl tpl: policy violations:
+ID       TPL  ISSUE
+##01.01  tpl  policy no-latest-tag: image tag latest is not allowed
+`,
+		},
+		{
+			it:       "should_not_fail_on_warn_violations",
+			severity: policy.SeverityWarn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			pol, err := policy.New([]policy.Rule{{
+				Name:       "no-latest-tag",
+				Severity:   tt.severity,
+				Kinds:      []string{"Pod"},
+				Expression: "object.spec.containers.all(c, !c.image.endsWith(':latest'))",
+				Message:    "image tag latest is not allowed",
+			}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			var out bytes.Buffer
+			x := &Execute{
+				Out: &out,
+				Log: logrtesting.TestLogger{T: t},
+			}
+
+			_, err = x.Apply(1, "tpl", ApplyOpt{Policy: pol}, []byte(docs))
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Empty(t, out.String(), "nothing is generated")
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package execute
+
+import (
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/exe"
+)
+
+// PostRenderer is a local executable that transforms the rendered yaml of a step.
+// It reads the multi-document yaml from stdin and writes the transformed yaml to stdout.
+type PostRenderer struct {
+	// Command is the path of the executable followed by its arguments.
+	Command []string
+	// Dir is the working directory of the executable.
+	Dir string
+}
+
+// PostRender returns the rendered yaml b transformed by pr.
+// A non-zero exit of the executable is an error.
+func (x *Execute) postRender(pr *PostRenderer, b []byte) ([]byte, error) {
+	if len(pr.Command) == 0 {
+		return b, nil
+	}
+	o := &exe.Opt{Dir: pr.Dir, Env: x.Environ}
+	stdout, _, err := exe.Run(nil, x.Log, o, string(b), pr.Command[0], pr.Command[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer: %w", err)
+	}
+	return []byte(stdout), nil
+}
@@ -0,0 +1,55 @@
+package execute
+
+import (
+	"bytes"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecute_Apply_postRenderer(t *testing.T) {
+	tests := []struct {
+		it      string
+		command []string
+		wantOut string
+		wantErr string
+	}{
+		{
+			it:      "should_apply_the_post_rendered_yaml",
+			command: []string{"sed", "s/name: a/name: b/"},
+			wantOut: `---
+##01.01: InstrApply [apply -f -] tpl
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    key: value
+  name: b
+
+`,
+		},
+		{
+			it:      "should_fail_on_non_zero_exit",
+			command: []string{"sh", "-c", "echo boom >&2; exit 3"},
+			wantErr: "tpl tpl: post-renderer: sh [-c echo boom >&2; exit 3]: exit status 3 - boom\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var out bytes.Buffer
+			x := &Execute{Out: &out, Log: logrtesting.TestLogger{T: t}}
+			opt := ApplyOpt{
+				Labels:       map[string]string{"key": "value"},
+				PostRenderer: &PostRenderer{Command: tt.command},
+			}
+			_, err := x.Apply(1, "tpl", opt, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantOut, out.String())
+			}
+		})
+	}
+}
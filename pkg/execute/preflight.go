@@ -0,0 +1,441 @@
+package execute
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	yaml2 "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+	"text/tabwriter"
+)
+
+// Permission is a verb on a resource in a namespace that is required by a run.
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	// Namespace is empty for cluster scoped resources.
+	Namespace string
+	// Name optionally limits the permission to a single object.
+	Name string
+	// RequiredBy is the step or document that requires the permission, like ##01.02 or prune.
+	RequiredBy string
+}
+
+// Preflight collects the permissions required by a run.
+type preflight struct {
+	// permissions in order of first use.
+	permissions []Permission
+	// index of permissions by key.
+	index map[string]bool
+	// defaultNamespace is the namespace of the kubectl context.
+	defaultNamespace string
+
+	// issues are the problems found in the rendered objects.
+	issues []issue
+	// kinds are the kinds that are created by CRDs in the job.
+	kinds []metav1.APIResource
+	// namespaces are the namespaces that exist in the cluster or are created in the job.
+	namespaces map[string]bool
+}
+
+// Issue is a problem with a rendered object.
+type issue struct {
+	// id is the step.document id of the object like 01.02
+	id string
+	// tpl is the template name.
+	tpl  string
+	text string
+}
+
+// BeginPreflight makes subsequent Apply, Prune and Action calls check objects and record the permissions they require
+// instead of changing the target cluster.
+func (x *Execute) BeginPreflight() {
+	x.preflight = &preflight{index: map[string]bool{}}
+}
+
+// EndPreflight checks the recorded permissions with SelfSubjectAccessReviews and returns an error with a table of
+// issues (kinds that aren't served, namespaces that don't exist, namespace set on cluster scoped kinds or vice versa)
+// and a table of missing permissions.
+func (x *Execute) EndPreflight() error {
+	p := x.preflight
+	x.preflight = nil
+	if p == nil {
+		return nil
+	}
+	if len(p.permissions) == 0 && len(p.issues) == 0 {
+		return nil
+	}
+
+	var issues string
+	if len(p.issues) > 0 {
+		issues = "issues:\n" + issuesTable(p.issues)
+	}
+
+	var allowed []bool
+	if len(p.permissions) > 0 {
+		var err error
+		allowed, err = x.accessReview(p.permissions)
+		if err != nil {
+			return fmt.Errorf("preflight: %s%w", issues, err)
+		}
+	}
+
+	var missing []Permission
+	for i, a := range allowed {
+		if !a {
+			missing = append(missing, p.permissions[i])
+		}
+	}
+
+	x.log("preflight", 0, 0, "", fmt.Sprintf("%d issues, %d permissions checked, %d missing",
+		len(p.issues), len(p.permissions), len(missing)))
+
+	if len(missing) > 0 {
+		return fmt.Errorf("preflight: %smissing permissions:\n%s", issues, permissionsTable(missing))
+	}
+	if issues != "" {
+		return fmt.Errorf("preflight: %s", issues)
+	}
+	return nil
+}
+
+// Require records a permission.
+func (p *preflight) require(perm Permission) {
+	k := strings.Join([]string{perm.Verb, perm.Group, perm.Resource, perm.Subresource, perm.Namespace, perm.Name}, "|")
+	if p.index[k] {
+		return
+	}
+	p.index[k] = true
+	p.permissions = append(p.permissions, perm)
+}
+
+// PreflightApply checks the kind and namespace of objects and records the permissions to apply them.
+func (x *Execute) preflightApply(name string, objects []object) error {
+	apiResources, err := x.getK8sAPIResources()
+	if err != nil {
+		return err
+	}
+	p := x.preflight
+
+	for _, o := range objects {
+		obj, err := decodeObject(o.doc)
+		if err != nil {
+			return fmt.Errorf("##%s tpl %s: %w", o.ID(), name, err)
+		}
+		knsn := NewKindNamespaceName(obj)
+
+		r, ok := apiResource(knsn.GVK, apiResources)
+		if !ok {
+			r, ok = apiResource(knsn.GVK, p.kinds)
+		}
+		if !ok {
+			if x.isUnavailable(knsn.GVK.Group) {
+				x.log("preflight", o.id, o.sub, name, "skipped "+knsn.GVK.Kind+" (api group is unavailable)")
+				continue
+			}
+			p.issue(o, name, fmt.Sprintf("kind %s is not served by the cluster or created by a CRD earlier in the job", gvkString(knsn.GVK)))
+			continue
+		}
+
+		// namespace usage.
+		switch {
+		case r.Namespaced && knsn.Namespace == "":
+			p.issue(o, name, fmt.Sprintf("namespace is missing on namespaced kind %s", knsn.GVK.Kind))
+		case !r.Namespaced && knsn.Namespace != "":
+			p.issue(o, name, fmt.Sprintf("namespace is set on cluster scoped kind %s", knsn.GVK.Kind))
+		case r.Namespaced:
+			exists, err := x.namespaceExists(knsn.Namespace)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				p.issue(o, name, fmt.Sprintf("namespace %s doesn't exist and isn't created earlier in the job", knsn.Namespace))
+			}
+		}
+
+		// objects that are needed by objects later in the job.
+		switch {
+		case knsn.GVK.Group == "" && knsn.GVK.Kind == "Namespace":
+			_, err := x.namespaceExists(knsn.Name)
+			if err != nil {
+				return err
+			}
+			p.namespaces[knsn.Name] = true
+		case knsn.GVK.Group == "apiextensions.k8s.io" && knsn.GVK.Kind == "CustomResourceDefinition":
+			p.kinds = append(p.kinds, crdResources(obj)...)
+		}
+
+		ns, err := x.objectNamespace(r, knsn.Namespace)
+		if err != nil {
+			return err
+		}
+		for _, v := range []string{"get", "create", "patch"} {
+			p.require(Permission{Verb: v, Group: r.Group, Resource: r.Name, Namespace: ns,
+				RequiredBy: "##" + o.ID() + " " + name})
+		}
+	}
+
+	return nil
+}
+
+// Issue records a problem with object o.
+func (p *preflight) issue(o object, tpl, text string) {
+	p.issues = append(p.issues, issue{id: o.ID(), tpl: tpl, text: text})
+}
+
+// NamespaceExists returns true when namespace exists in the cluster or is created earlier in the job.
+func (x *Execute) namespaceExists(namespace string) (bool, error) {
+	p := x.preflight
+	if p.namespaces == nil {
+		stdout, _, err := x.Kubectl.Run(nil, "", "get", "namespaces", "-o", "name")
+		if err != nil {
+			return false, fmt.Errorf("get namespaces: %w", err)
+		}
+		p.namespaces = map[string]bool{}
+		for _, n := range strings.Fields(stdout) {
+			p.namespaces[strings.TrimPrefix(n, "namespace/")] = true
+		}
+	}
+	return p.namespaces[namespace], nil
+}
+
+// CrdResources returns the API resources (one per served version) that are defined by CRD obj.
+// When the CRD lists no versions a single resource without version is returned.
+func crdResources(obj *unstructured.Unstructured) []metav1.APIResource {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	r := metav1.APIResource{
+		Name:       plural,
+		Namespaced: scope != "Cluster",
+		Group:      group,
+		Kind:       kind,
+	}
+
+	var versions []string
+	// apiextensions.k8s.io/v1beta1 CRDs might use version instead of versions.
+	if v, _, _ := unstructured.NestedString(obj.Object, "spec", "version"); v != "" {
+		versions = append(versions, v)
+	}
+	vs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+	for _, v := range vs {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(m, "name")
+		served, found, _ := unstructured.NestedBool(m, "served")
+		if name == "" || found && !served {
+			continue
+		}
+		versions = append(versions, name)
+	}
+	if len(versions) == 0 {
+		return []metav1.APIResource{r}
+	}
+
+	result := make([]metav1.APIResource, 0, len(versions))
+	for _, v := range versions {
+		r.Version = v
+		result = append(result, r)
+	}
+	return result
+}
+
+// GvkString returns gvk as group/version kind.
+func gvkString(gvk metav1.GroupVersionKind) string {
+	gv := gvk.Version
+	if gvk.Group != "" {
+		gv = gvk.Group + "/" + gv
+	}
+	return gv + " " + gvk.Kind
+}
+
+// PreflightPrune records the permissions to prune and to write the store.
+func (x *Execute) preflightPrune(id int, deployed []KindNamespaceName, opt PruneOpt) error {
+	by := fmt.Sprintf("##%02d prune", id)
+
+	kinds := "configmaps"
+	if storeKind(opt.Store) == "Secret" {
+		kinds = "secrets"
+	}
+	for _, v := range []string{"get", "create", "patch"} {
+		x.preflight.require(Permission{Verb: v, Resource: kinds, Namespace: opt.Store.Namespace, RequiredBy: by})
+	}
+	for _, r := range []string{"configmaps", "secrets"} {
+		for _, v := range []string{"list", "delete"} {
+			x.preflight.require(Permission{Verb: v, Resource: r, Namespace: opt.Store.Namespace, RequiredBy: by})
+		}
+	}
+
+	// objects that will be pruned.
+	cluster, err := x.readStore(opt.Store)
+	if err != nil {
+		// the get permission on the store is checked.
+		return nil
+	}
+	apiResources, err := x.getK8sAPIResources()
+	if err != nil {
+		return err
+	}
+	for _, k := range subtract(cluster, deployed) {
+		r, ok := apiResource(k.GVK, apiResources)
+		if !ok {
+			continue
+		}
+		for _, v := range []string{"get", "delete"} {
+			x.preflight.require(Permission{Verb: v, Group: r.Group, Resource: r.Name, Namespace: k.Namespace,
+				RequiredBy: by})
+		}
+	}
+
+	return nil
+}
+
+// PreflightAction records the permissions of an action and its port-forward.
+func (x *Execute) preflightAction(id int, name string, actionType string, doc []byte, portForward string) error {
+	by := fmt.Sprintf("##%02d %s", id, name)
+
+	if actionType == "getSecret" {
+		ac := &actionSecret{}
+		err := yaml2.Unmarshal(doc, ac)
+		if err != nil {
+			return fmt.Errorf("getSecret: %w", err)
+		}
+		x.preflight.require(Permission{Verb: "get", Resource: "secrets", Namespace: ac.Namespace, Name: ac.Name,
+			RequiredBy: by})
+	}
+
+	if portForward != "" {
+		ns, err := x.defaultNamespace()
+		if err != nil {
+			return err
+		}
+		args := strings.Fields(portForward)
+		for i, a := range args {
+			if (a == "-n" || a == "--namespace") && i+1 < len(args) {
+				ns = args[i+1]
+			} else if strings.HasPrefix(a, "--namespace=") {
+				ns = strings.TrimPrefix(a, "--namespace=")
+			}
+		}
+		x.preflight.require(Permission{Verb: "get", Resource: "pods", Namespace: ns, RequiredBy: by})
+		x.preflight.require(Permission{Verb: "create", Resource: "pods", Subresource: "portforward", Namespace: ns,
+			RequiredBy: by})
+	}
+
+	return nil
+}
+
+// ObjectNamespace returns the namespace in which an object of resource r with namespace ns is applied.
+func (x *Execute) objectNamespace(r metav1.APIResource, ns string) (string, error) {
+	if !r.Namespaced {
+		return "", nil
+	}
+	if ns != "" {
+		return ns, nil
+	}
+	return x.defaultNamespace()
+}
+
+// DefaultNamespace returns the namespace of the kubectl context.
+func (x *Execute) defaultNamespace() (string, error) {
+	if x.preflight != nil && x.preflight.defaultNamespace != "" {
+		return x.preflight.defaultNamespace, nil
+	}
+
+	stdout, _, err := x.Kubectl.Run(nil, "", "config", "view", "--minify", "-o", "jsonpath={..namespace}")
+	if err != nil {
+		return "", fmt.Errorf("default namespace: %w", err)
+	}
+	ns := strings.TrimSpace(stdout)
+	if ns == "" {
+		ns = "default"
+	}
+
+	if x.preflight != nil {
+		x.preflight.defaultNamespace = ns
+	}
+	return ns, nil
+}
+
+// AccessReview returns for each permission if it's allowed for the user of the target cluster.
+func (x *Execute) accessReview(perms []Permission) ([]bool, error) {
+	items := make([]map[string]interface{}, 0, len(perms))
+	for _, p := range perms {
+		items = append(items, map[string]interface{}{
+			"apiVersion": "authorization.k8s.io/v1",
+			"kind":       "SelfSubjectAccessReview",
+			"spec": map[string]interface{}{
+				"resourceAttributes": map[string]string{
+					"verb":        p.Verb,
+					"group":       p.Group,
+					"resource":    p.Resource,
+					"subresource": p.Subresource,
+					"namespace":   p.Namespace,
+					"name":        p.Name,
+				},
+			},
+		})
+	}
+	b, err := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, _, err := x.Kubectl.Run(nil, string(b), "create", "-f", "-", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("access review: %w", err)
+	}
+
+	reviews, err := decodeLiveObjects(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("access review: %w", err)
+	}
+	if len(reviews) != len(perms) {
+		return nil, fmt.Errorf("access review: expected %d results, got %d", len(perms), len(reviews))
+	}
+
+	r := make([]bool, len(reviews))
+	for i, rv := range reviews {
+		allowed, _, _ := unstructured.NestedBool(rv.Object, "status", "allowed")
+		r[i] = allowed
+	}
+	return r, nil
+}
+
+// IssuesTable returns issues as a text table.
+func issuesTable(issues []issue) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTPL\tISSUE")
+	for _, i := range issues {
+		fmt.Fprintf(w, "##%s\t%s\t%s\n", i.id, i.tpl, i.text)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// PermissionsTable returns perms as a text table.
+func permissionsTable(perms []Permission) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERB\tRESOURCE\tNAMESPACE\tNAME\tREQUIRED BY")
+	for _, p := range perms {
+		r := p.Resource
+		if p.Subresource != "" {
+			r += "/" + p.Subresource
+		}
+		if p.Group != "" {
+			r += "." + p.Group
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Verb, r, p.Namespace, p.Name, p.RequiredBy)
+	}
+	w.Flush()
+	return buf.String()
+}
@@ -0,0 +1,236 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func TestExecute_preflight_permissions(t *testing.T) {
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: ns1
+`
+	const getSecret = `type: getSecret
+namespace: ns2
+name: sec
+`
+	tests := []struct {
+		it      string
+		denied  map[string]bool
+		wantErr string
+	}{
+		{
+			it: "should_pass_when_all_permissions_are_allowed",
+		},
+		{
+			it:     "should_list_missing_permissions",
+			denied: map[string]bool{"patch deployments": true, "get secrets": true, "create pods": true},
+			wantErr: `preflight: missing permissions:
+VERB    RESOURCE          NAMESPACE  NAME  REQUIRED BY
+patch   deployments.apps  ns1              ##01.01 tpl
+get     secrets           ns2        sec   ##02 action
+create  pods/portforward  ns3              ##02 action
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{
+				Kubectl: fakeReviewer{denied: tt.denied},
+				Log:     logrtesting.TestLogger{T: t},
+				discovered: &discovery{resources: []metav1.APIResource{
+					{Group: "apps", Version: "v1", Kind: "Deployment", Name: "deployments", Namespaced: true},
+				}},
+			}
+
+			x.BeginPreflight()
+			_, err := x.Apply(1, "tpl", ApplyOpt{}, []byte(deployment))
+			assert.NoError(t, err)
+			err = x.Action(2, "action", []byte(getSecret), "-n ns3 pod/vault-0 8200", nil)
+			assert.NoError(t, err)
+			err = x.EndPreflight()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// FakeReviewer answers SelfSubjectAccessReviews, denied contains the denied 'verb resource' combinations.
+type fakeReviewer struct {
+	denied map[string]bool
+}
+
+func (k fakeReviewer) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	switch args[0] {
+	case "config":
+		return "ns1", "", nil
+	case "get":
+		return "namespace/ns1\nnamespace/ns2\n", "", nil
+	case "create":
+		list := &unstructured.UnstructuredList{}
+		err := json.Unmarshal([]byte(stdin), list)
+		if err != nil {
+			return "", "", err
+		}
+		for i, item := range list.Items {
+			verb, _, _ := unstructured.NestedString(item.Object, "spec", "resourceAttributes", "verb")
+			res, _, _ := unstructured.NestedString(item.Object, "spec", "resourceAttributes", "resource")
+			_ = unstructured.SetNestedField(list.Items[i].Object, !k.denied[verb+" "+res], "status", "allowed")
+		}
+		b, err := json.Marshal(list)
+		return string(b), "", err
+	}
+	return "", "", fmt.Errorf("fakeReviewer: unexpected %v", args)
+}
+
+func TestExecute_preflight_issues(t *testing.T) {
+	tests := []struct {
+		it      string
+		doc     string
+		wantErr string
+	}{
+		{
+			it: "should_accept_kinds_and_namespaces_created_earlier",
+			doc: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: new
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+spec:
+  group: example.com
+  names:
+    kind: Example
+    plural: examples
+  scope: Namespaced
+---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+  namespace: new
+`,
+		},
+		{
+			it: "should_report_issues",
+			doc: `apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+  namespace: ns1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: missing
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+  namespace: ns1
+`,
+			wantErr: `preflight: issues:
+ID       TPL  ISSUE
+##01.01  tpl  kind example.com/v1 Example is not served by the cluster or created by a CRD earlier in the job
+##01.02  tpl  namespace is missing on namespaced kind ConfigMap
+##01.03  tpl  namespace missing doesn't exist and isn't created earlier in the job
+##01.04  tpl  namespace is set on cluster scoped kind Namespace
+`,
+		},
+		{
+			it: "should_report_versions_that_are_not_served",
+			doc: `apiVersion: autoscaling/v2beta1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: hpa
+  namespace: ns1
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: hpa
+  namespace: ns1
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+spec:
+  group: example.com
+  names:
+    kind: Example
+    plural: examples
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+  - name: v1alpha1
+    served: false
+---
+apiVersion: example.com/v1alpha1
+kind: Example
+metadata:
+  name: x
+  namespace: ns1
+---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: x
+  namespace: ns1
+`,
+			wantErr: `preflight: issues:
+ID       TPL  ISSUE
+##01.01  tpl  kind autoscaling/v2beta1 HorizontalPodAutoscaler is not served by the cluster or created by a CRD earlier in the job
+##01.04  tpl  kind example.com/v1alpha1 Example is not served by the cluster or created by a CRD earlier in the job
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{
+				Kubectl: fakeReviewer{},
+				Log:     logrtesting.TestLogger{T: t},
+				discovered: &discovery{resources: []metav1.APIResource{
+					{Version: "v1", Kind: "Namespace", Name: "namespaces"},
+					{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+					{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition", Name: "customresourcedefinitions"},
+					{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler", Name: "horizontalpodautoscalers", Namespaced: true},
+				}},
+			}
+
+			x.BeginPreflight()
+			_, err := x.Apply(1, "tpl", ApplyOpt{}, []byte(tt.doc))
+			assert.NoError(t, err)
+			err = x.EndPreflight()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
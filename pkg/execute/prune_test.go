@@ -0,0 +1,143 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecute_Prune_pending(t *testing.T) {
+	cm := func(name string) KindNamespaceName {
+		return KindNamespaceName{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Namespace: "ns", Name: name}
+	}
+	opt := PruneOpt{Store: Store{Namespace: "default", Name: "st"}, Wait: true}
+
+	k := &fakePruneCluster{
+		store: fakeCluster{},
+		resources: []metav1.APIResource{
+			{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+		},
+		live: map[string]string{
+			"configmaps./ns/old": `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"old","namespace":"ns","finalizers":["example.com/x"]}}`,
+		},
+		finalizing: map[string]bool{"configmaps./ns/old": true},
+	}
+	x := &Execute{Kubectl: k, DeleteTimeout: time.Millisecond, Log: logrtesting.TestLogger{T: t}}
+	err := x.writeStore(opt.Store, []KindNamespaceName{cm("old"), cm("keep")})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = x.Prune(2, []KindNamespaceName{cm("keep"), cm("new")}, opt)
+	assert.Error(t, err, "old is not deleted")
+	assert.Equal(t, []string{"configmaps./ns/old"}, k.deleted)
+
+	old := cm("old")
+	old.GVK.Version = "" // subtract ignores versions.
+	got, err := x.readStore(opt.Store)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []KindNamespaceName{cm("keep"), cm("new"), old}, got,
+			"new objects are recorded and pending objects are kept for the next run")
+	}
+}
+
+func TestExecute_Prune_rediscover(t *testing.T) {
+	ex := KindNamespaceName{GVK: metav1.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Example"}, Namespace: "ns", Name: "x"}
+	opt := PruneOpt{Store: Store{Namespace: "default", Name: "st"}}
+
+	k := &fakePruneCluster{
+		store: fakeCluster{},
+		resources: []metav1.APIResource{
+			{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+		},
+	}
+	x := &Execute{Kubectl: k, Log: logrtesting.TestLogger{T: t}}
+	// fill the discovery cache before the CRD of Example is applied.
+	_, err := x.isNamespaced(metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	k.resources = append(k.resources, metav1.APIResource{Group: "example.com", Version: "v1", Kind: "Example", Name: "examples", Namespaced: true})
+
+	err = x.Prune(2, []KindNamespaceName{ex}, opt)
+	assert.NoError(t, err)
+}
+
+// FakePruneCluster serves discovery, live objects and (via fakeCluster) the prune store.
+type fakePruneCluster struct {
+	store fakeCluster
+	// resources served by discovery (with Group and Version set).
+	resources []metav1.APIResource
+	// live objects (JSON) by resource/namespace/name.
+	live map[string]string
+	// finalizing objects are not removed by delete.
+	finalizing map[string]bool
+	// deleted are the resource/namespace/name of the deleted objects.
+	deleted []string
+}
+
+func (c *fakePruneCluster) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	switch {
+	case len(args) == 3 && args[0] == "get" && args[1] == "--raw":
+		return c.discovery(args[2])
+	case args[0] == "get":
+		return c.live[liveKey(args)], "", nil
+	case args[0] == "delete":
+		k := liveKey(args)
+		c.deleted = append(c.deleted, k)
+		if !c.finalizing[k] {
+			delete(c.live, k)
+		}
+		return "", "", nil
+	}
+	return c.store.Run(ctx, stdin, args...)
+}
+
+// Discovery returns the response of discovery endpoint path.
+func (c *fakePruneCluster) discovery(path string) (string, string, error) {
+	var v interface{}
+	switch path {
+	case "/api":
+		v = metav1.APIVersions{Versions: []string{"v1"}}
+	case "/apis":
+		l := metav1.APIGroupList{}
+		seen := map[string]bool{}
+		for _, r := range c.resources {
+			gv := metav1.GroupVersion{Group: r.Group, Version: r.Version}.String()
+			if r.Group == "" || seen[gv] {
+				continue
+			}
+			seen[gv] = true
+			l.Groups = append(l.Groups, metav1.APIGroup{Name: r.Group,
+				Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: gv, Version: r.Version}}})
+		}
+		v = l
+	default:
+		gv := strings.TrimPrefix(strings.TrimPrefix(path, "/apis/"), "/api/")
+		l := metav1.APIResourceList{GroupVersion: gv}
+		for _, r := range c.resources {
+			if (metav1.GroupVersion{Group: r.Group, Version: r.Version}).String() == gv {
+				l.APIResources = append(l.APIResources, metav1.APIResource{Name: r.Name, Kind: r.Kind, Namespaced: r.Namespaced})
+			}
+		}
+		v = l
+	}
+	b, err := json.Marshal(v)
+	return string(b), "", err
+}
+
+// LiveKey returns resource/namespace/name of the object in kubectl get or delete args.
+func liveKey(args []string) string {
+	var ns string
+	for i := 3; i < len(args)-1; i++ {
+		if args[i] == "-n" {
+			ns = args[i+1]
+		}
+	}
+	return args[1] + "/" + ns + "/" + args[2]
+}
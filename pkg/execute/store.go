@@ -1,49 +1,116 @@
 package execute
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"strings"
 )
 
 // Store config.
 type Store struct {
 	// Namespace were data is stored.
-	Namespace string
+	Namespace string `yaml:"namespace"`
 	// Name of ConfigMap were data is stored.
-	Name string
+	Name string `yaml:"name"`
+	// Kind of object were data is stored; ConfigMap (default) or Secret.
+	Kind string `yaml:"kind"`
+	// Compress stores data gzip compressed and base64 encoded.
+	Compress bool `yaml:"compress"`
+	// ShardSize is the max number of data bytes per object (default 100KiB).
+	// Larger data is spread over additional objects named <Name>-1, <Name>-2 etc.
+	ShardSize int `yaml:"shardSize"`
+	// History is the number of revisions to keep in <Name>-history, zero disables history.
+	History int `yaml:"history"`
+	// Manifests adds the applied objects to each revision, this is required for rollback.
+	Manifests bool `yaml:"manifests"`
 	// Xtra key/values to store.
-	X map[string]string
+	X map[string]string `yaml:"x"`
 }
 
+// Store object keys, labels and values.
+const (
+	// storeKeyDeployed is the key of the uncompressed, unsharded (original) format.
+	storeKeyDeployed = "deployed"
+	// storeKeyEncoding is the key of the encoding of the chunks, see encoding* constants.
+	storeKeyEncoding = "encoding"
+	// storeKeyShards is the key of the number of objects the chunks are spread over.
+	storeKeyShards = "shards"
+	// storeKeyChunk is the key of a part of the encoded data.
+	storeKeyChunk = "chunk"
+
+	// storeLabel is set on all store objects, its value is the store name.
+	storeLabel = "deploy.mmlt.nl/store"
+
+	encodingJSON = "json"
+	encodingGzip = "gzip+base64"
+
+	// defaultShardSize keeps objects well below the 256KiB limit of the last-applied-configuration annotation.
+	defaultShardSize = 100 * 1024
+)
+
 // ReadStore reads deployed objects from store.
+// Both the original format (a single ConfigMap with a 'deployed' field) and the compressed/sharded formats are read.
 func (x *Execute) readStore(store Store) ([]KindNamespaceName, error) {
-	args := []string{"-n", store.Namespace, "get", "configmap", store.Name, "-o", "json"}
-	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+	b, err := x.readStoreData(store)
 	if err != nil {
-		return nil, fmt.Errorf("get configmap: %w", err)
+		return nil, err
 	}
 
-	// process output
-	cm := &corev1.ConfigMap{}
-	err = json.Unmarshal([]byte(stdout), cm)
+	r := &[]KindNamespaceName{}
+	err = json.Unmarshal(b, r)
 	if err != nil {
-		return nil, fmt.Errorf("get configmap %s/%s: %w", store.Namespace, store.Name, err)
+		return nil, fmt.Errorf("get %s %s/%s deployed data: %w", strings.ToLower(storeKind(store)), store.Namespace, store.Name, err)
 	}
 
-	s, ok := cm.Data["deployed"]
-	if !ok {
-		return nil, fmt.Errorf("get configmap %s/%s: no field 'deployed'", store.Namespace, store.Name)
+	return *r, nil
+}
+
+// ReadStoreData reads the (decoded) data from store.
+func (x *Execute) readStoreData(store Store) ([]byte, error) {
+	kind := storeKind(store)
+	data, err := x.getStoreData(kind, store.Namespace, store.Name)
+	if err != nil && isNotFound(err) {
+		// the store might still be in the kind of object it was before store.kind was changed.
+		d, err2 := x.getStoreData(otherStoreKind(kind), store.Namespace, store.Name)
+		if err2 == nil {
+			kind, data, err = otherStoreKind(kind), d, nil
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	r := &[]KindNamespaceName{}
-	err = json.Unmarshal([]byte(s), r)
+	if s, ok := data[storeKeyDeployed]; ok {
+		return []byte(s), nil
+	}
+
+	return x.readStoreChunks(kind, store, data)
+}
+
+// ReadStoreChunks reads the chunks referred to by the data of the main store object and returns the decoded result.
+func (x *Execute) readStoreChunks(kind string, store Store, data map[string]string) ([]byte, error) {
+	n, err := strconv.Atoi(data[storeKeyShards])
 	if err != nil {
-		return nil, fmt.Errorf("get configmap %s/%s 'deployed' field: %w", store.Namespace, store.Name, err)
+		return nil, fmt.Errorf("get %s %s/%s: no field 'deployed' or 'shards'", strings.ToLower(kind), store.Namespace, store.Name)
 	}
 
-	return *r, nil
+	chunks := []string{data[storeKeyChunk]}
+	for i := 1; i < n; i++ {
+		d, err := x.getStoreData(kind, store.Namespace, shardName(store.Name, i))
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, d[storeKeyChunk])
+	}
+
+	return decodeStoreData(data[storeKeyEncoding], strings.Join(chunks, ""))
 }
 
 // WriteStore writes deployed objects to store.
@@ -53,30 +120,103 @@ func (x *Execute) writeStore(store Store, deployed []KindNamespaceName) error {
 		return err
 	}
 
-	cm := &corev1.ConfigMap{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "v1",
-			Kind:       "ConfigMap",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      store.Name,
-			Namespace: store.Namespace,
-		},
-		Data: map[string]string{
-			"deployed": string(b),
-		},
+	return x.writeStoreData(store, b)
+}
+
+// WriteStoreData writes b and the store X kv's to store.
+func (x *Execute) writeStoreData(store Store, b []byte) error {
+	var err error
+
+	kind := storeKind(store)
+	shardSize := store.ShardSize
+	if shardSize <= 0 {
+		shardSize = defaultShardSize
+	}
+
+	// data per object, the first is the main object.
+	var datas []map[string]string
+	if kind == "ConfigMap" && !store.Compress && len(b) <= shardSize {
+		// original format.
+		datas = append(datas, map[string]string{
+			storeKeyDeployed: string(b),
+		})
+	} else {
+		enc, s := encodingJSON, string(b)
+		if store.Compress {
+			enc = encodingGzip
+			s, err = gzipBase64(b)
+			if err != nil {
+				return err
+			}
+		}
+		chunks := split(s, shardSize)
+		for _, c := range chunks {
+			datas = append(datas, map[string]string{
+				storeKeyChunk: c,
+			})
+		}
+		datas[0][storeKeyEncoding] = enc
+		datas[0][storeKeyShards] = strconv.Itoa(len(chunks))
 	}
 
 	// add store X kv's
 	for k, v := range store.X {
-		if _, ok := cm.Data[k]; ok {
+		if _, ok := datas[0][k]; ok {
 			// don't overwrite entries
 			continue
 		}
-		cm.Data[k] = v
+		datas[0][k] = v
+	}
+
+	// write shards before the main object that refers to them.
+	keep := map[string]bool{}
+	for i := len(datas) - 1; i >= 0; i-- {
+		name := shardName(store.Name, i)
+		keep[strings.ToLower(kind)+"/"+name] = true
+		err = x.applyStoreObject(kind, store.Namespace, name, store.Name, datas[i])
+		if err != nil {
+			return err
+		}
 	}
 
-	d, err := json.Marshal(cm)
+	if x.DryRun {
+		return nil
+	}
+
+	return x.deleteStaleStoreObjects(store, keep)
+}
+
+// ApplyStoreObject applies a ConfigMap or Secret with data.
+func (x *Execute) applyStoreObject(kind, namespace, name, storeName string, data map[string]string) error {
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			storeLabel: storeName,
+		},
+	}
+
+	var obj interface{}
+	switch kind {
+	case "Secret":
+		d := make(map[string][]byte, len(data))
+		for k, v := range data {
+			d[k] = []byte(v)
+		}
+		obj = &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: meta,
+			Data:       d,
+		}
+	default:
+		obj = &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: meta,
+			Data:       data,
+		}
+	}
+
+	d, err := json.Marshal(obj)
 	if err != nil {
 		return err
 	}
@@ -92,3 +232,142 @@ func (x *Execute) writeStore(store Store, deployed []KindNamespaceName) error {
 
 	return nil
 }
+
+// DeleteStaleStoreObjects deletes the store objects that are not in keep.
+// Stale objects are shards that are no longer needed and objects of the kind that was used before store.kind changed.
+func (x *Execute) deleteStaleStoreObjects(store Store, keep map[string]bool) error {
+	args := []string{"-n", store.Namespace, "get", "configmap,secret", "-l", storeLabel + "=" + store.Name, "-o", "name"}
+	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return fmt.Errorf("get store objects: %w", err)
+	}
+
+	var stale []string
+	for _, n := range strings.Fields(stdout) {
+		if !keep[n] {
+			stale = append(stale, n)
+		}
+	}
+	if storeKind(store) == "Secret" && !keep["configmap/"+store.Name] {
+		// ConfigMap in the original format (without label).
+		stale = append(stale, "configmap/"+store.Name)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	args = append([]string{"-n", store.Namespace, "delete", "--ignore-not-found"}, stale...)
+	_, _, err = x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return fmt.Errorf("delete store objects: %w", err)
+	}
+
+	return nil
+}
+
+// GetStoreData returns the data of a ConfigMap or Secret.
+func (x *Execute) getStoreData(kind, namespace, name string) (map[string]string, error) {
+	k := strings.ToLower(kind)
+	args := []string{"-n", namespace, "get", k, name, "-o", "json"}
+	stdout, _, err := x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", k, err)
+	}
+
+	// process output
+	switch kind {
+	case "Secret":
+		s := &corev1.Secret{}
+		err = json.Unmarshal([]byte(stdout), s)
+		if err != nil {
+			return nil, fmt.Errorf("get %s %s/%s: %w", k, namespace, name, err)
+		}
+		r := make(map[string]string, len(s.Data))
+		for k, v := range s.Data {
+			r[k] = string(v)
+		}
+		return r, nil
+	default:
+		cm := &corev1.ConfigMap{}
+		err = json.Unmarshal([]byte(stdout), cm)
+		if err != nil {
+			return nil, fmt.Errorf("get %s %s/%s: %w", k, namespace, name, err)
+		}
+		return cm.Data, nil
+	}
+}
+
+// StoreKind returns the kind of object store data is kept in.
+func storeKind(store Store) string {
+	if store.Kind == "Secret" {
+		return "Secret"
+	}
+	return "ConfigMap"
+}
+
+// OtherStoreKind returns Secret for ConfigMap and vise versa.
+func otherStoreKind(kind string) string {
+	if kind == "Secret" {
+		return "ConfigMap"
+	}
+	return "Secret"
+}
+
+// ShardName returns the name of the i-th store object.
+func shardName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", name, i)
+}
+
+// IsNotFound returns true when err is a kubectl NotFound error.
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "Error from server (NotFound):")
+}
+
+// Split splits s in chunks of max size bytes.
+func split(s string, size int) []string {
+	var r []string
+	for len(s) > size {
+		r = append(r, s[:size])
+		s = s[size:]
+	}
+	return append(r, s)
+}
+
+// GzipBase64 returns b gzip compressed and base64 encoded.
+func gzipBase64(b []byte) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(b)
+	if err != nil {
+		return "", err
+	}
+	err = zw.Close()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeStoreData decodes s according to encoding.
+func decodeStoreData(encoding, s string) ([]byte, error) {
+	switch encoding {
+	case encodingJSON:
+		return []byte(s), nil
+	case encodingGzip:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("store data: %w", err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("store data: %w", err)
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("store data: unknown encoding: %s", encoding)
+	}
+}
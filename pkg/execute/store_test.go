@@ -0,0 +1,154 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExecute_store(t *testing.T) {
+	deployed := []KindNamespaceName{
+		{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "Namespace"}, Name: "ns"},
+		{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, Namespace: "ns", Name: "cm1"},
+		{GVK: metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, Namespace: "ns", Name: "app"},
+	}
+
+	tests := []struct {
+		it string
+		// cluster are the objects in the cluster before the store is read.
+		cluster fakeCluster
+		store   Store
+		// wantRead is the list read from the store before writing deployed.
+		wantRead []KindNamespaceName
+		// wantObjects are the names of the objects in the cluster after writing deployed.
+		wantObjects []string
+		// wantKey is a key that is present in the main store object.
+		wantKey string
+	}{
+		{
+			it:          "should_write_the_original_format_by_default",
+			cluster:     fakeCluster{},
+			store:       Store{Namespace: "default", Name: "st"},
+			wantObjects: []string{"configmap/st"},
+			wantKey:     storeKeyDeployed,
+		},
+		{
+			it:          "should_write_compressed_data_in_a_secret",
+			cluster:     fakeCluster{},
+			store:       Store{Namespace: "default", Name: "st", Kind: "Secret", Compress: true},
+			wantObjects: []string{"secret/st"},
+			wantKey:     storeKeyChunk,
+		},
+		{
+			it:          "should_shard_data_over_multiple_objects",
+			cluster:     fakeCluster{},
+			store:       Store{Namespace: "default", Name: "st", ShardSize: 100},
+			wantObjects: []string{"configmap/st", "configmap/st-1", "configmap/st-2"},
+			wantKey:     storeKeyShards,
+		},
+		{
+			it: "should_migrate_the_original_format_to_a_sharded_secret",
+			cluster: fakeCluster{
+				"configmap/st": `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"st","namespace":"default"},"data":{"deployed":"[{\"GVK\":{\"Group\":\"\",\"Version\":\"v1\",\"Kind\":\"Secret\"},\"Namespace\":\"ns\",\"Name\":\"old\"}]"}}`,
+			},
+			store: Store{Namespace: "default", Name: "st", Kind: "Secret", Compress: true, ShardSize: 50},
+			wantRead: []KindNamespaceName{
+				{GVK: metav1.GroupVersionKind{Version: "v1", Kind: "Secret"}, Namespace: "ns", Name: "old"},
+			},
+			wantObjects: []string{"secret/st", "secret/st-1", "secret/st-2", "secret/st-3"},
+			wantKey:     storeKeyEncoding,
+		},
+		{
+			it: "should_delete_shards_that_are_no_longer_needed",
+			cluster: fakeCluster{
+				"configmap/st-4": `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"st-4","namespace":"default","labels":{"deploy.mmlt.nl/store":"st"}},"data":{"chunk":""}}`,
+			},
+			store:       Store{Namespace: "default", Name: "st", ShardSize: 100},
+			wantObjects: []string{"configmap/st", "configmap/st-1", "configmap/st-2"},
+			wantKey:     storeKeyShards,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{Kubectl: tt.cluster}
+
+			if tt.wantRead != nil {
+				got, err := x.readStore(tt.store)
+				if assert.NoError(t, err) {
+					assert.Equal(t, tt.wantRead, got)
+				}
+			}
+
+			err := x.writeStore(tt.store, deployed)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.wantObjects, tt.cluster.names())
+
+			data, err := x.getStoreData(storeKind(tt.store), tt.store.Namespace, tt.store.Name)
+			if assert.NoError(t, err) {
+				assert.Contains(t, data, tt.wantKey)
+			}
+
+			got, err := x.readStore(tt.store)
+			if assert.NoError(t, err) {
+				assert.Equal(t, deployed, got)
+			}
+		})
+	}
+}
+
+// FakeCluster is a minimal in-memory cluster that supports the kubectl commands used by the store.
+// Objects are JSON texts keyed by kind/name.
+type fakeCluster map[string]string
+
+func (c fakeCluster) Run(ctx context.Context, stdin string, args ...string) (string, string, error) {
+	a := strings.Join(args, " ")
+	switch {
+	case len(args) >= 3 && args[0] == "apply":
+		obj := &metav1.PartialObjectMetadata{}
+		err := json.Unmarshal([]byte(stdin), obj)
+		if err != nil {
+			return "", "", err
+		}
+		c[strings.ToLower(obj.Kind)+"/"+obj.Name] = stdin
+		return "", "", nil
+	case len(args) == 7 && args[2] == "get" && args[4] != "-l":
+		s, ok := c[args[3]+"/"+args[4]]
+		if !ok {
+			return "", "", fmt.Errorf("kubectl %s: Error from server (NotFound): not found", a)
+		}
+		return s, "", nil
+	case len(args) == 8 && args[2] == "get" && args[4] == "-l":
+		var names []string
+		for _, n := range c.names() {
+			obj := &metav1.PartialObjectMetadata{}
+			_ = json.Unmarshal([]byte(c[n]), obj)
+			if kv := strings.SplitN(args[5], "=", 2); obj.Labels[kv[0]] == kv[1] {
+				names = append(names, n)
+			}
+		}
+		return strings.Join(names, "\n"), "", nil
+	case len(args) > 3 && args[2] == "delete":
+		for _, n := range args[4:] {
+			delete(c, n)
+		}
+		return "", "", nil
+	}
+	return "", "", fmt.Errorf("fakeCluster: unexpected kubectl %s", a)
+}
+
+// Names returns the sorted kind/name of all objects in the cluster.
+func (c fakeCluster) names() []string {
+	var r []string
+	for n := range c {
+		r = append(r, n)
+	}
+	sort.Strings(r)
+	return r
+}
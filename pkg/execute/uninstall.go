@@ -0,0 +1,119 @@
+package execute
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Uninstall deletes all objects that are recorded in the store and finally the store itself.
+func (x *Execute) Uninstall(id int, opt PruneOpt) error {
+	idmin := 0
+
+	apiResources, err := x.getK8sAPIResources()
+	if err != nil {
+		return err
+	}
+
+	idmin++
+	x.log("uninstall", id, idmin, "", "read store")
+	list, err := x.readStore(opt.Store)
+	if err != nil {
+		if isNotFound(err) {
+			idmin++
+			x.log("uninstall", id, idmin, "", "skipped: no store found")
+			return nil
+		}
+		return fmt.Errorf("uninstall read store: %w", err)
+	}
+
+	sortInDeleteOrder(list)
+
+	// Delete
+	var deleted []deletion
+	backupDir := x.backupDir(opt)
+	for _, r := range list {
+		rn, err := resource(r.GVK, apiResources)
+		if err != nil {
+			if isListKind(r.GVK) {
+				// recorded before List items were tracked individually.
+				continue
+			}
+			return err
+		}
+		args := []string{"delete", rn, r.Name, "--wait=false"}
+		if r.Namespace != "" {
+			args = append(args, "-n", r.Namespace)
+		}
+		idmin++
+		live, err := x.getLive(rn, r)
+		if err != nil {
+			return fmt.Errorf("uninstall: %w", err)
+		}
+		if reason := pruneProtection(live, StoreOwner(opt.Store)); reason != "" {
+			x.log("uninstall", id, idmin, "", "skipped "+strings.Join(args, " ")+" ("+reason+")")
+			continue
+		}
+		if x.NoDelete || x.DryRun {
+			x.log("uninstall", id, idmin, "", "skipped "+strings.Join(args, " "))
+			continue
+		}
+		if backupDir != "" {
+			err = x.backup(backupDir, live)
+			if err != nil {
+				return fmt.Errorf("uninstall backup: %w", err)
+			}
+		}
+		x.log("uninstall", id, idmin, "", strings.Join(args, " "))
+		_, _, err = x.Kubectl.Run(nil, "", args...)
+		if err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+		deleted = append(deleted, deletion{resource: rn, knsn: r})
+	}
+
+	if x.NoDelete || x.DryRun {
+		idmin++
+		x.log("uninstall", id, idmin, "", "skipped: delete store")
+		return nil
+	}
+
+	// Wait
+	idmin++
+	x.log("uninstall", id, idmin, "", "wait for deletion")
+	_, err = x.completeDeletion(deleted, opt.RemoveFinalizers)
+	if err != nil {
+		// keep the store so uninstall can be retried.
+		return fmt.Errorf("uninstall: %w", err)
+	}
+
+	// Delete store
+	idmin++
+	x.log("uninstall", id, idmin, "", "delete store")
+	err = x.deleteStore(opt.Store)
+	if err != nil {
+		return err
+	}
+
+	idmin++
+	x.log("uninstall", id, idmin, "", "done")
+	return nil
+}
+
+// DeleteStore deletes all objects of a store including its history and step hashes.
+func (x *Execute) deleteStore(store Store) error {
+	sel := fmt.Sprintf("%s in (%s,%s,%s)", storeLabel, store.Name, historyStore(store).Name, stepsStore(store).Name)
+	args := []string{"-n", store.Namespace, "delete", "configmap,secret", "-l", sel}
+	_, _, err := x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return fmt.Errorf("delete store: %w", err)
+	}
+
+	// ConfigMap in the original format (without label).
+	args = []string{"-n", store.Namespace, "delete", "configmap", store.Name, "--ignore-not-found"}
+	_, _, err = x.Kubectl.Run(nil, "", args...)
+	if err != nil {
+		return fmt.Errorf("delete store: %w", err)
+	}
+
+	return nil
+}
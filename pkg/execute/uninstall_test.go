@@ -0,0 +1,54 @@
+package execute
+
+import (
+	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExecute_Uninstall(t *testing.T) {
+	// cluster with a store that contains a ConfigMap that is blocked by a finalizer.
+	cluster := func() fakeKubectlArgs {
+		return fakeKubectlArgs{
+			"get --raw /api":  `{"kind":"APIVersions","versions":["v1"]}`,
+			"get --raw /apis": `{"kind":"APIGroupList","groups":[]}`,
+			"get --raw /api/v1": `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+{"name":"configmaps","singularName":"","namespaced":true,"kind":"ConfigMap","verbs":["get"]}]}`,
+			"-n default get configmap st -o json":                 `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"st","namespace":"default"},"data":{"deployed":"[{\"GVK\":{\"Group\":\"\",\"Version\":\"v1\",\"Kind\":\"ConfigMap\"},\"Namespace\":\"ns\",\"Name\":\"cm\"}]"}}`,
+			"get configmaps. cm --ignore-not-found -o json -n ns": `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns","finalizers":["example.com/stuck"]}}`,
+			"delete configmaps. cm --wait=false -n ns":            "",
+		}
+	}
+
+	tests := []struct {
+		it       string
+		noDelete bool
+		wantErr  string
+	}{
+		{
+			it:      "should_report_objects_blocked_by_finalizers_and_keep_the_store",
+			wantErr: "uninstall: objects not deleted within 1ms:\n, v1, ConfigMap, ns, cm, finalizers: example.com/stuck\n",
+		},
+		{
+			it:       "should_not_delete_when_no_delete_is_set",
+			noDelete: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			x := &Execute{
+				Kubectl:       cluster(),
+				NoDelete:      tt.noDelete,
+				DeleteTimeout: time.Millisecond,
+				Log:           logrtesting.TestLogger{T: t},
+			}
+			err := x.Uninstall(1, PruneOpt{Store: Store{Namespace: "default", Name: "st"}})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package images rewrites container image references (for example to use a registry mirror) and pins them to digests.
+package images
+
+import (
+	"fmt"
+	yaml2 "gopkg.in/yaml.v2"
+	"strings"
+)
+
+// Config configures image rewriting.
+type Config struct {
+	// Rewrite rules, the first matching rule is used.
+	Rewrite []Rule `yaml:"rewrite"`
+	// LockFile is a yaml file with image references (before rewriting) and their digests.
+	LockFile string `yaml:"lockFile"`
+	// Paths are the locations of images in custom resources.
+	Paths []Path `yaml:"paths"`
+}
+
+// Rule rewrites images that match From to To.
+// From matches the fully qualified reference (like docker.io/library/nginx:1.19) or its repository (without tag).
+// A trailing * in From matches any remainder, the remainder replaces a trailing * in To.
+// For example 'docker.io/*' to 'mirror.local/*' rewrites nginx:1.19 to mirror.local/library/nginx:1.19
+type Rule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Path is the location of image references in objects of a kind.
+type Path struct {
+	// Kind of the object.
+	Kind string `yaml:"kind"`
+	// Path is a dot separated path to an image, [] selects all items of a list like spec.containers[].image
+	Path string `yaml:"path"`
+}
+
+// Rewriter rewrites and pins image references.
+type Rewriter struct {
+	rules []Rule
+	// digests by image reference.
+	digests map[string]string
+	// paths by kind.
+	paths map[string][][]string
+}
+
+// New returns a Rewriter for cfg.
+// Lock is the content of cfg.LockFile (if any), a yaml map of image references to digests like
+// 'docker.io/library/nginx:1.19: sha256:0123...'.
+func New(cfg Config, lock []byte) (*Rewriter, error) {
+	r := &Rewriter{
+		digests: map[string]string{},
+		paths:   map[string][][]string{},
+	}
+
+	for _, rl := range cfg.Rewrite {
+		if rl.From == "" || rl.To == "" {
+			return nil, fmt.Errorf("image rewrite rule: from and to are required: %v", rl)
+		}
+		if strings.HasSuffix(rl.To, "*") && !strings.HasSuffix(rl.From, "*") {
+			return nil, fmt.Errorf("image rewrite rule %s: 'to' ends with * but 'from' doesn't", rl.From)
+		}
+		r.rules = append(r.rules, rl)
+	}
+
+	if len(lock) > 0 {
+		var m map[string]string
+		err := yaml2.Unmarshal(lock, &m)
+		if err != nil {
+			return nil, fmt.Errorf("image lock file: %w", err)
+		}
+		for k, v := range m {
+			if !strings.Contains(v, ":") {
+				return nil, fmt.Errorf("image lock file: %s: expected a digest like sha256:0123... instead of: %s", k, v)
+			}
+			r.digests[Normalize(k)] = v
+		}
+	}
+
+	for _, p := range cfg.Paths {
+		if p.Kind == "" || p.Path == "" {
+			return nil, fmt.Errorf("image path: kind and path are required: %v", p)
+		}
+		r.paths[p.Kind] = append(r.paths[p.Kind], splitPath(p.Path))
+	}
+
+	return r, nil
+}
+
+// Paths returns the configured image paths of kind.
+func (r *Rewriter) Paths(kind string) [][]string {
+	return r.paths[kind]
+}
+
+// Rewrite returns image rewritten by the first matching rule and pinned to the digest in the lock file.
+// Images that don't match a rule or lock file entry are returned as is.
+func (r *Rewriter) Rewrite(image string) string {
+	n := Normalize(image)
+
+	result := image
+	for _, rl := range r.rules {
+		if s, ok := rewrite(n, rl); ok {
+			result = s
+			break
+		}
+	}
+
+	if strings.Contains(result, "@") {
+		// already pinned.
+		return result
+	}
+	d, ok := r.digests[n]
+	if !ok {
+		d, ok = r.digests[Normalize(result)]
+	}
+	if ok {
+		result += "@" + d
+	}
+	return result
+}
+
+// Rewrite applies rule rl to the normalized image n.
+func rewrite(n string, rl Rule) (string, bool) {
+	if strings.HasSuffix(rl.From, "*") {
+		prefix := strings.TrimSuffix(rl.From, "*")
+		if !strings.HasPrefix(n, prefix) {
+			return "", false
+		}
+		rest := strings.TrimPrefix(n, prefix)
+		if strings.HasSuffix(rl.To, "*") {
+			return strings.TrimSuffix(rl.To, "*") + rest, true
+		}
+		return rl.To, true
+	}
+
+	if n == rl.From {
+		return rl.To, true
+	}
+	repo, suffix := splitRepository(n)
+	if repo == rl.From {
+		return rl.To + suffix, true
+	}
+	return "", false
+}
+
+// Normalize returns the fully qualified form of image, for example nginx:1.19 becomes docker.io/library/nginx:1.19
+func Normalize(image string) string {
+	name := image
+	i := strings.Index(name, "/")
+	if i < 0 || !strings.ContainsAny(name[:i], ".:") && name[:i] != "localhost" {
+		if i < 0 {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	return name
+}
+
+// SplitRepository splits the normalized image n in repository and :tag and/or @digest suffix.
+func splitRepository(n string) (string, string) {
+	end := len(n)
+	if i := strings.Index(n, "@"); i >= 0 {
+		end = i
+	}
+	// a tag follows the last / (a : before that is a registry port).
+	if i := strings.LastIndex(n[:end], ":"); i > strings.LastIndex(n[:end], "/") {
+		end = i
+	}
+	return n[:end], n[end:]
+}
+
+// SplitPath turns a path like spec.containers[].image into [spec containers [] image].
+func splitPath(path string) []string {
+	var r []string
+	for _, p := range strings.Split(path, ".") {
+		if strings.HasSuffix(p, "[]") {
+			r = append(r, strings.TrimSuffix(p, "[]"), "[]")
+			continue
+		}
+		r = append(r, p)
+	}
+	return r
+}
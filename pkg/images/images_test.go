@@ -0,0 +1,62 @@
+package images
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRewriter_Rewrite(t *testing.T) {
+	cfg := Config{
+		Rewrite: []Rule{
+			{From: "docker.io/library/busybox", To: "mirror.local/tools/busybox"},
+			{From: "docker.io/*", To: "mirror.local/*"},
+			{From: "quay.io/*", To: "mirror.local/quay/*"},
+		},
+	}
+	lock := []byte(`
+nginx:1.19: sha256:aaa
+quay.io/x/y:v1: sha256:bbb
+`)
+
+	tests := []struct {
+		it    string
+		image string
+		want  string
+	}{
+		{it: "should_rewrite_implicit_docker_hub_image", image: "redis:6", want: "mirror.local/library/redis:6"},
+		{it: "should_rewrite_repository_and_keep_tag", image: "busybox:1.32", want: "mirror.local/tools/busybox:1.32"},
+		{it: "should_rewrite_and_pin", image: "nginx:1.19", want: "mirror.local/library/nginx:1.19@sha256:aaa"},
+		{it: "should_pin_by_normalized_name", image: "docker.io/library/nginx:1.19", want: "mirror.local/library/nginx:1.19@sha256:aaa"},
+		{it: "should_rewrite_other_registry", image: "quay.io/x/y:v1", want: "mirror.local/quay/x/y:v1@sha256:bbb"},
+		{it: "should_keep_existing_digest", image: "quay.io/x/y:v1@sha256:ccc", want: "mirror.local/quay/x/y:v1@sha256:ccc"},
+		{it: "should_keep_unmatched_image", image: "localhost:5000/app:1", want: "localhost:5000/app:1"},
+	}
+
+	r, err := New(cfg, lock)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Rewrite(tt.image))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", "docker.io/library/nginx"},
+		{"user/app:1", "docker.io/user/app:1"},
+		{"registry.example.com/app:1", "registry.example.com/app:1"},
+		{"registry:5000/app", "registry:5000/app"},
+		{"localhost/app", "localhost/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.want, Normalize(tt.image))
+		})
+	}
+}
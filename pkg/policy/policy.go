@@ -0,0 +1,198 @@
+// Package policy evaluates organisation rules written in CEL against rendered Kubernetes objects.
+package policy
+
+import (
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	yaml2 "gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Severities of a rule.
+const (
+	// SeverityDeny rules fail the run when violated.
+	SeverityDeny = "deny"
+	// SeverityWarn rules are logged when violated.
+	SeverityWarn = "warn"
+)
+
+// ExemptAnnotation is the object annotation with a comma separated list of rule names that the object is exempt from.
+// A value of * exempts the object from all rules.
+const ExemptAnnotation = "deploy.mmlt.nl/policy-exempt"
+
+// Rule is a CEL expression that must evaluate to true for each (selected) object.
+type Rule struct {
+	// Name identifies the rule in reports and exemptions.
+	Name string `yaml:"name"`
+	// Severity is deny (default) or warn.
+	Severity string `yaml:"severity"`
+	// Kinds limits the rule to objects of these kinds (case insensitive), all kinds when empty.
+	Kinds []string `yaml:"kinds"`
+	// Expression is a CEL expression with variable 'object' that evaluates to true when the object complies.
+	Expression string `yaml:"expression"`
+	// Message describes the violation.
+	Message string `yaml:"message"`
+}
+
+// Violation is a rule that is violated by an object.
+type Violation struct {
+	Rule     string
+	Severity string
+	Message  string
+}
+
+// Policy is a set of compiled rules.
+type Policy struct {
+	rules []rule
+}
+
+// Rule is a compiled Rule.
+type rule struct {
+	Rule
+	program cel.Program
+}
+
+// New returns a Policy with rules compiled.
+func New(rules []Rule) (*Policy, error) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType), ext.Strings())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{}
+	names := map[string]bool{}
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("policy rule without name: %s", r.Expression)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("policy rule %s: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityDeny
+		case SeverityDeny, SeverityWarn:
+		default:
+			return nil, fmt.Errorf("policy rule %s: severity must be one of [deny,warn] instead of: %s", r.Name, r.Severity)
+		}
+
+		ast, iss := env.Compile(r.Expression)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("policy rule %s: %w", r.Name, iss.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("policy rule %s: expression must return a bool instead of: %s", r.Name, ast.OutputType())
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %s: %w", r.Name, err)
+		}
+
+		p.rules = append(p.rules, rule{Rule: r, program: prg})
+	}
+
+	return p, nil
+}
+
+// ReadDir returns the rules in the yaml files in dir, each file contains a list of rules.
+func ReadDir(dir string) ([]Rule, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("policy dir: %w", err)
+	}
+
+	var r []Rule
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".yaml", ".yml":
+		default:
+			continue
+		}
+		p := filepath.Join(dir, f.Name())
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("policy dir: %w", err)
+		}
+		var rules []Rule
+		err = yaml2.UnmarshalStrict(b, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("policy file %s: %w", p, err)
+		}
+		r = append(r, rules...)
+	}
+
+	return r, nil
+}
+
+// Evaluate returns the rules that are violated by obj (a decoded Kubernetes object).
+// Rules listed in the ExemptAnnotation of obj are skipped.
+// A rule that fails to evaluate (for example because a field is absent) is reported as violated.
+func (p *Policy) Evaluate(obj map[string]interface{}) []Violation {
+	kind, _ := obj["kind"].(string)
+	exempt := exemptions(obj)
+
+	var r []Violation
+	for _, rl := range p.rules {
+		if exempt["*"] || exempt[rl.Name] || !SelectKind(rl.Kinds, kind) {
+			continue
+		}
+
+		msg := rl.Message
+		if msg == "" {
+			msg = "expected: " + strings.TrimSpace(rl.Expression)
+		}
+
+		out, _, err := rl.program.Eval(map[string]interface{}{"object": obj})
+		if err != nil {
+			r = append(r, Violation{Rule: rl.Name, Severity: rl.Severity, Message: msg + " (" + err.Error() + ")"})
+			continue
+		}
+		ok, isBool := out.Value().(bool)
+		if !isBool {
+			r = append(r, Violation{Rule: rl.Name, Severity: rl.Severity,
+				Message: fmt.Sprintf("%s (expression returned %v instead of a bool)", msg, out.Value())})
+			continue
+		}
+		if !ok {
+			r = append(r, Violation{Rule: rl.Name, Severity: rl.Severity, Message: msg})
+		}
+	}
+
+	return r
+}
+
+// Exemptions returns the rule names in the ExemptAnnotation of obj.
+func exemptions(obj map[string]interface{}) map[string]bool {
+	md, _ := obj["metadata"].(map[string]interface{})
+	an, _ := md["annotations"].(map[string]interface{})
+	v, _ := an[ExemptAnnotation].(string)
+
+	r := map[string]bool{}
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			r[n] = true
+		}
+	}
+	return r
+}
+
+// SelectKind returns true when kinds is empty or contains kind (case insensitive).
+func SelectKind(kinds []string, kind string) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
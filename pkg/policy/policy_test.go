@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:       "no-latest-tag",
+			Kinds:      []string{"deployment"},
+			Expression: "object.spec.template.spec.containers.all(c, !c.image.endsWith(':latest'))",
+			Message:    "image tag latest is not allowed",
+		},
+		{
+			Name:       "limits",
+			Severity:   SeverityWarn,
+			Kinds:      []string{"Deployment"},
+			Expression: "object.spec.template.spec.containers.all(c, has(c.resources) && has(c.resources.limits))",
+		},
+		{
+			Name:       "no-host-path",
+			Expression: "!has(object.spec) || !has(object.spec.template) || !has(object.spec.template.spec.volumes) || object.spec.template.spec.volumes.all(v, !has(v.hostPath))",
+			Message:    "hostPath volumes are not allowed",
+		},
+	}
+
+	tests := []struct {
+		it   string
+		obj  string
+		want []Violation
+	}{
+		{
+			it: "should_accept_compliant_object",
+			obj: `
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx:1.19
+        resources:
+          limits:
+            cpu: 1`,
+		},
+		{
+			it: "should_report_violations",
+			obj: `
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx:latest
+      volumes:
+      - hostPath:
+          path: /`,
+			want: []Violation{
+				{Rule: "no-latest-tag", Severity: SeverityDeny, Message: "image tag latest is not allowed"},
+				{Rule: "limits", Severity: SeverityWarn,
+					Message: "expected: object.spec.template.spec.containers.all(c, has(c.resources) && has(c.resources.limits))"},
+				{Rule: "no-host-path", Severity: SeverityDeny, Message: "hostPath volumes are not allowed"},
+			},
+		},
+		{
+			it: "should_skip_exempt_rules",
+			obj: `
+kind: Deployment
+metadata:
+  annotations:
+    deploy.mmlt.nl/policy-exempt: "limits, no-host-path"
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx:latest
+      volumes:
+      - hostPath:
+          path: /`,
+			want: []Violation{
+				{Rule: "no-latest-tag", Severity: SeverityDeny, Message: "image tag latest is not allowed"},
+			},
+		},
+		{
+			it: "should_skip_all_rules",
+			obj: `
+kind: Deployment
+metadata:
+  annotations:
+    deploy.mmlt.nl/policy-exempt: "*"
+spec: {}`,
+		},
+		{
+			it: "should_report_evaluation_errors",
+			obj: `
+kind: Deployment
+spec: {}`,
+			want: []Violation{
+				{Rule: "no-latest-tag", Severity: SeverityDeny, Message: "image tag latest is not allowed (no such key: template)"},
+				{Rule: "limits", Severity: SeverityWarn,
+					Message: "expected: object.spec.template.spec.containers.all(c, has(c.resources) && has(c.resources.limits)) (no such key: template)"},
+			},
+		},
+		{
+			it: "should_only_evaluate_rules_for_selected_kinds",
+			obj: `
+kind: ConfigMap
+data: {}`,
+		},
+	}
+
+	p, err := New(rules)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var obj map[string]interface{}
+			err := yaml.Unmarshal([]byte(tt.obj), &obj)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := p.Evaluate(obj)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		it      string
+		rules   []Rule
+		wantErr string
+	}{
+		{
+			it:      "should_reject_unknown_severity",
+			rules:   []Rule{{Name: "x", Severity: "error", Expression: "true"}},
+			wantErr: "policy rule x: severity must be one of [deny,warn] instead of: error",
+		},
+		{
+			it:      "should_reject_non_bool_expression",
+			rules:   []Rule{{Name: "x", Expression: "'text'"}},
+			wantErr: "policy rule x: expression must return a bool instead of: string",
+		},
+		{
+			it:      "should_reject_duplicate_names",
+			rules:   []Rule{{Name: "x", Expression: "true"}, {Name: "x", Expression: "true"}},
+			wantErr: "policy rule x: duplicate name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			_, err := New(tt.rules)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSelectKind(t *testing.T) {
+	assert.True(t, SelectKind(nil, "Deployment"), "empty kinds select all")
+	assert.True(t, SelectKind([]string{"Service", "deployment"}, "Deployment"), "case insensitive")
+	assert.False(t, SelectKind([]string{"Service"}, "Deployment"))
+}
@@ -0,0 +1,73 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/mmlt/kubectl-tmplt/pkg/execute"
+	"github.com/mmlt/kubectl-tmplt/pkg/util/exe"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Run annotations that can be added to all objects, see job file apply.runAnnotations.
+const (
+	// RunAnnotationTime adds the time of deployment.
+	RunAnnotationTime = "time"
+	// RunAnnotationJobFile adds the path of the job file.
+	RunAnnotationJobFile = "jobFile"
+	// RunAnnotationGitCommit adds the git commit of the repo that contains the job file.
+	RunAnnotationGitCommit = "gitCommit"
+	// RunAnnotationVersion adds the tool version.
+	RunAnnotationVersion = "version"
+)
+
+// Annotations returns the common annotations merged with the run annotations selected by names.
+func (t *Tool) annotations(common map[string]string, names []string) (map[string]string, error) {
+	r := map[string]string{}
+	for k, v := range common {
+		r[k] = v
+	}
+
+	for _, n := range names {
+		switch n {
+		case RunAnnotationTime:
+			r[execute.TimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		case RunAnnotationJobFile:
+			r[execute.JobFileAnnotation] = t.JobFilepath
+		case RunAnnotationGitCommit:
+			c, err := t.gitCommit()
+			if err != nil {
+				return nil, err
+			}
+			r[execute.GitCommitAnnotation] = c
+		case RunAnnotationVersion:
+			r[execute.VersionAnnotation] = t.Version
+		default:
+			return nil, fmt.Errorf("unknown run annotation: %s", n)
+		}
+	}
+
+	return r, nil
+}
+
+// GitCommit returns the commit of the git repo that contains the job file.
+// A '-dirty' suffix is added when the working tree has uncommitted changes.
+func (t *Tool) gitCommit() (string, error) {
+	o := &exe.Opt{Dir: filepath.Dir(t.JobFilepath), Env: t.Environ}
+
+	stdout, _, err := exe.Run(nil, t.Log, o, "", "git", "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("git commit: %w", err)
+	}
+	c := strings.TrimSpace(stdout)
+
+	stdout, _, err = exe.Run(nil, t.Log, o, "", "git", "status", "--porcelain")
+	if err != nil {
+		return "", fmt.Errorf("git status: %w", err)
+	}
+	if strings.TrimSpace(stdout) != "" {
+		c += "-dirty"
+	}
+
+	return c, nil
+}
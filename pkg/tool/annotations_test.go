@@ -0,0 +1,50 @@
+package tool
+
+import (
+	"github.com/mmlt/kubectl-tmplt/pkg/execute"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTool_annotations(t *testing.T) {
+	tests := []struct {
+		it      string
+		common  map[string]string
+		names   []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			it:   "should_return_no_annotations",
+			want: map[string]string{},
+		},
+		{
+			it:     "should_merge_common_and_run_annotations",
+			common: map[string]string{"team": "a"},
+			names:  []string{RunAnnotationJobFile, RunAnnotationVersion},
+			want: map[string]string{
+				"team":                    "a",
+				execute.JobFileAnnotation: "jobs/job.yaml",
+				execute.VersionAnnotation: "v1.2.3",
+			},
+		},
+		{
+			it:      "should_reject_unknown_run_annotation",
+			names:   []string{"x"},
+			wantErr: "unknown run annotation: x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			tl := &Tool{JobFilepath: "jobs/job.yaml", Version: "v1.2.3"}
+			got, err := tl.annotations(tt.common, tt.names)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package tool
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"github.com/go-logr/logr"
@@ -9,10 +10,13 @@ import (
 	"github.com/mmlt/kubectl-tmplt/pkg/azure"
 	"github.com/mmlt/kubectl-tmplt/pkg/execute"
 	"github.com/mmlt/kubectl-tmplt/pkg/expand"
+	"github.com/mmlt/kubectl-tmplt/pkg/images"
+	"github.com/mmlt/kubectl-tmplt/pkg/policy"
 	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
 	yaml2 "gopkg.in/yaml.v2"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"text/template"
 )
 
@@ -37,6 +41,14 @@ type Tool struct {
 	//	url - URL of Vault
 	//	clientID, clientSecret - Credential to access vault (cli credentials are used if absent)
 	VaultPath string
+	// Revision is the store history revision to rollback to (ModeRollback only).
+	Revision int
+	// Version of the tool, see RunAnnotationVersion.
+	Version string
+	// Preflight checks the permissions of the target cluster user before applying (ModePreflight only checks).
+	Preflight bool
+	// PolicyDir is a directory with yaml files with policy rules that are evaluated against all objects.
+	PolicyDir string
 
 	// Execute knows how to perform apply, wait and actions on target cluster.
 	Execute Executor
@@ -49,6 +61,9 @@ type Tool struct {
 
 	// Vault allows reading from the master-vault.
 	vault getter
+
+	// preflighting is true while the steps are performed to collect the required permissions.
+	preflighting bool
 }
 
 // Mode selects what the Tool should do; see Mode* constants for more.
@@ -68,6 +83,17 @@ const (
 	// ModeApplyWithActions generates and applies templates and actions to the target cluster.
 	ModeApplyWithActions = ModeApply | ModeActions
 
+	// ModeHistory lists the revisions in the prune store history.
+	ModeHistory Mode = 1 << iota
+	// ModeRollback applies the objects of a previous revision and prunes objects that are not in that revision.
+	ModeRollback Mode = 1 << iota
+	// ModeUninstall deletes all objects recorded in the prune store and the store itself.
+	ModeUninstall Mode = 1 << iota
+	// ModePreflight checks if the target cluster user has the permissions to apply the job.
+	ModePreflight Mode = 1 << iota
+	// ModeLint validates the generated objects against schemas without accessing the target cluster.
+	ModeLint Mode = 1 << iota
+
 	// The following Modes can only be used in combination with above modes.
 
 	// ModeActions is true for a modes that perform actions.
@@ -77,9 +103,24 @@ const (
 // Executor provides methods to apply a step to the target cluster or write a textual representation to out.
 type Executor interface {
 	Wait(id int, flags string) error
-	Apply(id int, name string, labels map[string]string, doc []byte) ([]execute.KindNamespaceName, error)
-	Prune(id int, deployed []execute.KindNamespaceName, store execute.Store) error
+	Apply(id int, name string, opt execute.ApplyOpt, doc []byte) ([]execute.KindNamespaceName, error)
+	Prune(id int, deployed []execute.KindNamespaceName, opt execute.PruneOpt) error
+	History(opt execute.PruneOpt) error
+	Rollback(id int, revision int, opt execute.PruneOpt) error
+	Uninstall(id int, opt execute.PruneOpt) error
 	Action(id int, name string, doc []byte, portForward string, passedValues *yamlx.Values) error
+	// BeginPreflight makes subsequent calls record the permissions they require instead of changing the target cluster.
+	BeginPreflight()
+	// EndPreflight returns an error when recorded permissions are missing.
+	EndPreflight() error
+	// BeginLint makes subsequent calls validate objects instead of changing the target cluster.
+	BeginLint() error
+	// EndLint returns an error when objects are invalid.
+	EndLint() error
+	// BeginGenerate makes subsequent calls write the generated steps to a directory tree (when configured).
+	BeginGenerate() error
+	// EndGenerate completes the directory tree.
+	EndGenerate() error
 }
 
 // Getter allows reading object fields from master key vault.
@@ -103,8 +144,18 @@ func ModeFromString(arg string) (Mode, error) {
 		return ModeGenerate, nil
 	case "generate-with-actions":
 		return ModeGenerateWithActions, nil
-	}
-	return ModeUnknown, fmt.Errorf("expected mode to be one of [apply,apply-with-actions,generate,generate-with-actions] instead of: %s", arg)
+	case "history":
+		return ModeHistory, nil
+	case "rollback":
+		return ModeRollback, nil
+	case "uninstall":
+		return ModeUninstall, nil
+	case "preflight":
+		return ModePreflight | ModeActions, nil
+	case "lint":
+		return ModeLint, nil
+	}
+	return ModeUnknown, fmt.Errorf("expected mode to be one of [apply,apply-with-actions,generate,generate-with-actions,history,rollback,uninstall,preflight,lint] instead of: %s", arg)
 }
 
 // Run runs the Tool.
@@ -167,13 +218,45 @@ func (t *Tool) run(setValues yamlx.Values, values, job []byte) error {
 	// process job.
 
 	j := &struct {
+		// apply configures how objects are applied.
+		Apply struct {
+			// order in which the objects of a step are applied.
+			Order string
+			// batch applies the objects of a step with a single kubectl invocation.
+			Batch bool
+			// incremental skips unchanged steps (requires prune.store).
+			Incremental bool
+			// commonAnnotations to add to all objects.
+			CommonAnnotations map[string]string `yaml:"commonAnnotations"`
+			// runAnnotations to add to all objects, see RunAnnotation* constants.
+			RunAnnotations []string `yaml:"runAnnotations"`
+			// annotationKinds limits the objects that get common and run annotations to these kinds.
+			AnnotationKinds []string `yaml:"annotationKinds"`
+			// checksums adds checksum annotations to workloads that reference ConfigMaps or Secrets of the job.
+			Checksums bool
+			// namespace to set on namespaced objects without namespace (can be overridden per step).
+			Namespace string
+			// subjectNamespaces sets the namespace of RoleBinding ServiceAccount subjects without namespace.
+			SubjectNamespaces bool `yaml:"subjectNamespaces"`
+			// images rewrites and pins container images.
+			Images *images.Config
+		}
+		// policy rules that are evaluated against all objects.
+		Policy struct {
+			// dir (relative to the job file) with yaml files with rules.
+			Dir string
+			// rules in addition to the ones in dir.
+			Rules []policy.Rule
+		}
 		// prune configures the pruning of old objects.
 		Prune struct {
 			// labels to add to all objects.
 			Labels map[string]string
-			// store config.
-			Store execute.Store
+			// order and store config.
+			execute.PruneOpt `yaml:",inline"`
 		}
+		// postRenderer is an executable (and arguments) that transforms the rendered yaml of each tmplt step.
+		PostRenderer string `yaml:"postRenderer"`
 		// steps to run.
 		Steps []yamlx.Values
 		// default values for steps.
@@ -200,6 +283,167 @@ func (t *Tool) run(setValues yamlx.Values, values, job []byte) error {
 		return fmt.Errorf("j file %s (after expand): %w", t.JobFilepath, err)
 	}
 
+	hasStore := len(j.Prune.Store.Name) > 0 && len(j.Prune.Store.Namespace) > 0
+	j.Prune.JobHash = fmt.Sprintf("%x", sha256.Sum256(job))
+
+	switch {
+	case t.Mode&ModeHistory != 0:
+		if !hasStore {
+			return fmt.Errorf("history: job file %s has no prune.store", t.JobFilepath)
+		}
+		return t.Execute.History(j.Prune.PruneOpt)
+	case t.Mode&ModeRollback != 0:
+		if !hasStore {
+			return fmt.Errorf("rollback: job file %s has no prune.store", t.JobFilepath)
+		}
+		return t.Execute.Rollback(1, t.Revision, j.Prune.PruneOpt)
+	case t.Mode&ModeUninstall != 0:
+		if !hasStore {
+			return fmt.Errorf("uninstall: job file %s has no prune.store", t.JobFilepath)
+		}
+		return t.Execute.Uninstall(1, j.Prune.PruneOpt)
+	}
+
+	applyOpt := execute.ApplyOpt{
+		Labels:            j.Prune.Labels,
+		Order:             j.Apply.Order,
+		Batch:             j.Apply.Batch,
+		Checksums:         j.Apply.Checksums,
+		Namespace:         j.Apply.Namespace,
+		SubjectNamespaces: j.Apply.SubjectNamespaces,
+	}
+	if hasStore {
+		applyOpt.Owner = execute.StoreOwner(j.Prune.Store)
+	}
+	if len(j.Apply.CommonAnnotations) > 0 || len(j.Apply.RunAnnotations) > 0 {
+		applyOpt.Annotations, err = t.annotations(j.Apply.CommonAnnotations, j.Apply.RunAnnotations)
+		if err != nil {
+			return fmt.Errorf("job file %s: apply: %w", t.JobFilepath, err)
+		}
+		applyOpt.AnnotationKinds = j.Apply.AnnotationKinds
+	}
+	applyOpt.Policy, err = t.policy(j.Policy.Dir, j.Policy.Rules)
+	if err != nil {
+		return err
+	}
+	if j.Apply.Images != nil {
+		applyOpt.Images, err = t.images(*j.Apply.Images)
+		if err != nil {
+			return fmt.Errorf("job file %s: apply: %w", t.JobFilepath, err)
+		}
+	}
+	applyOpt.PostRenderer, err = t.postRenderer(j.PostRenderer)
+	if err != nil {
+		return fmt.Errorf("job file %s: %w", t.JobFilepath, err)
+	}
+	if j.Apply.Incremental && t.Mode&(ModeGenerate|ModeLint) == 0 {
+		if !hasStore {
+			return fmt.Errorf("apply.incremental: job file %s has no prune.store", t.JobFilepath)
+		}
+		applyOpt.Incremental = true
+		applyOpt.Store = j.Prune.Store
+	}
+
+	if t.Mode&ModeLint != 0 {
+		err = t.Execute.BeginLint()
+		if err != nil {
+			return err
+		}
+		err = t.steps(j.Steps, j.Defaults, globalValues, applyOpt, hasStore, j.Prune.PruneOpt)
+		if err != nil {
+			return fmt.Errorf("lint: %w", err)
+		}
+		return t.Execute.EndLint()
+	}
+
+	if t.Mode&ModePreflight != 0 || t.Preflight {
+		t.Execute.BeginPreflight()
+		t.preflighting = true
+		err = t.steps(j.Steps, j.Defaults, globalValues, applyOpt, hasStore, j.Prune.PruneOpt)
+		t.preflighting = false
+		if err != nil {
+			return fmt.Errorf("preflight: %w", err)
+		}
+		err = t.Execute.EndPreflight()
+		if err != nil || t.Mode&ModePreflight != 0 {
+			return err
+		}
+	}
+
+	if t.Mode&ModeGenerate != 0 {
+		err = t.Execute.BeginGenerate()
+		if err != nil {
+			return err
+		}
+		err = t.steps(j.Steps, j.Defaults, globalValues, applyOpt, hasStore, j.Prune.PruneOpt)
+		if err != nil {
+			return err
+		}
+		return t.Execute.EndGenerate()
+	}
+
+	return t.steps(j.Steps, j.Defaults, globalValues, applyOpt, hasStore, j.Prune.PruneOpt)
+}
+
+// Policy returns the policy with the rules in PolicyDir, the job policy dir and the job policy rules or nil when there
+// are no rules.
+func (t *Tool) policy(dir string, rules []policy.Rule) (*policy.Policy, error) {
+	var all []policy.Rule
+	if t.PolicyDir != "" {
+		rs, err := policy.ReadDir(t.PolicyDir)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, rs...)
+	}
+	if dir != "" {
+		rs, err := policy.ReadDir(filepath.Join(filepath.Dir(t.JobFilepath), dir))
+		if err != nil {
+			return nil, fmt.Errorf("job file %s: %w", t.JobFilepath, err)
+		}
+		all = append(all, rs...)
+	}
+	all = append(all, rules...)
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	return policy.New(all)
+}
+
+// Images returns the image Rewriter for cfg, the lock file is relative to the job file.
+func (t *Tool) images(cfg images.Config) (*images.Rewriter, error) {
+	var lock []byte
+	if cfg.LockFile != "" {
+		var err error
+		lock, err = ioutil.ReadFile(filepath.Join(filepath.Dir(t.JobFilepath), cfg.LockFile))
+		if err != nil {
+			return nil, fmt.Errorf("images: %w", err)
+		}
+	}
+	return images.New(cfg, lock)
+}
+
+// PostRenderer returns the post-renderer for command, an executable followed by arguments.
+// A relative executable path (like ./bin/render) is relative to the job file, a name without path is looked up in PATH.
+func (t *Tool) postRenderer(command string) (*execute.PostRenderer, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	// an absolute dir because the executable is run in dir.
+	dir, err := filepath.Abs(filepath.Dir(t.JobFilepath))
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer: %w", err)
+	}
+	if strings.ContainsRune(args[0], filepath.Separator) && !filepath.IsAbs(args[0]) {
+		args[0] = filepath.Join(dir, args[0])
+	}
+	return &execute.PostRenderer{Command: args, Dir: dir}, nil
+}
+
+// Steps performs all steps and prunes the objects that are no longer deployed.
+func (t *Tool) steps(steps []yamlx.Values, defaults, globalValues yamlx.Values, applyOpt execute.ApplyOpt, hasStore bool, pruneOpt execute.PruneOpt) error {
 	// the resources that are deployed to the cluster.
 	var deployedKNSNs []execute.KindNamespaceName
 
@@ -209,8 +453,8 @@ func (t *Tool) run(setValues yamlx.Values, values, job []byte) error {
 	id := 1
 
 	// perform steps.
-	for _, stp := range j.Steps {
-		knsns, err := t.step(id, stp, j.Defaults, globalValues, j.Prune.Labels, &passedValues)
+	for _, stp := range steps {
+		knsns, err := t.step(id, stp, defaults, globalValues, applyOpt, &passedValues)
 		if err != nil {
 			return err
 		}
@@ -218,8 +462,8 @@ func (t *Tool) run(setValues yamlx.Values, values, job []byte) error {
 		id++
 	}
 
-	if len(j.Prune.Store.Name) > 0 && len(j.Prune.Store.Namespace) > 0 && t.Mode&ModeGenerate == 0 {
-		err = t.Execute.Prune(id, deployedKNSNs, j.Prune.Store)
+	if hasStore && t.Mode&(ModeGenerate|ModeLint) == 0 {
+		err := t.Execute.Prune(id, deployedKNSNs, pruneOpt)
 		if err != nil {
 			return err
 		}
@@ -228,7 +472,7 @@ func (t *Tool) run(setValues yamlx.Values, values, job []byte) error {
 }
 
 // Step performs a step.
-func (t *Tool) step(id int, stp, defaultValues, globalValues yamlx.Values, labels map[string]string, passedValues *yamlx.Values) ([]execute.KindNamespaceName, error) {
+func (t *Tool) step(id int, stp, defaultValues, globalValues yamlx.Values, applyOpt execute.ApplyOpt, passedValues *yamlx.Values) ([]execute.KindNamespaceName, error) {
 	s, err := decodeStep(stp)
 	if err != nil {
 		return nil, err
@@ -262,7 +506,12 @@ func (t *Tool) step(id int, stp, defaultValues, globalValues yamlx.Values, label
 
 	b, err := expand.Run(t.Environ, p, b1, vs, *passedValues, t.tmpltFunctions())
 	if err != nil {
-		return nil, fmt.Errorf("expand %s: %w", tmpltPath, err)
+		if t.preflighting && st == TypeAction {
+			// the values passed by previous actions are absent during preflight.
+			b = nil
+		} else {
+			return nil, fmt.Errorf("expand %s: %w", tmpltPath, err)
+		}
 	}
 
 	var knsns []execute.KindNamespaceName
@@ -270,7 +519,17 @@ func (t *Tool) step(id int, stp, defaultValues, globalValues yamlx.Values, label
 	n := filepath.Base(tmpltPath)
 	switch st {
 	case TypeTmplt:
-		knsns, err = t.Execute.Apply(id, n, labels, b)
+		if s.Namespace != "" {
+			applyOpt.Namespace = s.Namespace
+		}
+		applyOpt.Patches = s.Patches
+		if s.PostRenderer != "" {
+			applyOpt.PostRenderer, err = t.postRenderer(s.PostRenderer)
+			if err != nil {
+				return nil, fmt.Errorf("tmplt %s: %w", n, err)
+			}
+		}
+		knsns, err = t.Execute.Apply(id, n, applyOpt, b)
 	case TypeAction:
 		err = t.Execute.Action(id, n, b, s.PortForward, passedValues)
 	}
@@ -328,6 +587,16 @@ type genericStep struct {
 	// PortForward are the flags passed to a concurrently executed 'kubectl port-forward'
 	// (ICW A)
 	PortForward string `yaml:"portForward"`
+	// Namespace to set on namespaced objects without namespace, it overrides the job apply namespace.
+	// (ICW T)
+	Namespace string `yaml:"namespace"`
+	// Patches modify the objects rendered by the template.
+	// (ICW T)
+	Patches []execute.Patch `yaml:"patches"`
+	// PostRenderer is an executable (and arguments) that transforms the rendered yaml, it overrides the job
+	// postRenderer.
+	// (ICW T)
+	PostRenderer string `yaml:"postRenderer"`
 	// Values are the template scoped variables.
 	// (ICW A, T)
 	Values yamlx.Values `yaml:"values"`
@@ -1,15 +1,20 @@
 package tool
 
 import (
+	"bytes"
 	"fmt"
+	logrtesting "github.com/go-logr/logr/testing"
 	"github.com/mmlt/kubectl-tmplt/pkg/execute"
 	"github.com/mmlt/kubectl-tmplt/pkg/util/yamlx"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
-// See test/e2e for tests that use the file system.
+// See test/e2e for tests that use the file system; TestTool_postRenderer only writes a post-renderer to a temp dir.
 
 // TestTool tests without accessing filesystem, target cluster or master vault.
 func TestTool(t *testing.T) {
@@ -210,6 +215,42 @@ defaults:
 	}
 }
 
+// TestTool_postRenderer tests that a relative post-renderer path is relative to a relative job file.
+func TestTool_postRenderer(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "jobs", "bin"), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "jobs", "bin", "render"), []byte("#!/bin/sh\nsed 's/name: a/name: b/'\n"), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+	wd, err := os.Getwd()
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = os.Chdir(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Chdir(wd)
+
+	var out bytes.Buffer
+	tl := Tool{
+		Mode:        ModeGenerate,
+		JobFilepath: "jobs/job.yaml",
+		Execute:     &execute.Execute{Out: &out, Log: logrtesting.TestLogger{T: t}},
+		readFileFn: func(path string) (string, []byte, error) {
+			return path, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"), nil
+		},
+	}
+	err = tl.run(nil, nil, []byte("steps:\n- tmplt: tpl/cm.yaml\npostRenderer: ./bin/render\n"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, out.String(), "name: b")
+	}
+}
+
 // FakeDoer records calls and provides return values.
 type fakeDoer struct {
 	wait         []string
@@ -227,12 +268,32 @@ func (m *fakeDoer) Wait(id int, flags string) error {
 	return nil
 }
 
-func (m *fakeDoer) Apply(id int, name string, labels map[string]string, doc []byte) ([]execute.KindNamespaceName, error) {
+func (m *fakeDoer) Apply(id int, name string, opt execute.ApplyOpt, doc []byte) ([]execute.KindNamespaceName, error) {
 	m.apply = append(m.apply, string(doc))
 	return nil /*TODO*/, nil
 }
 
-func (m *fakeDoer) Prune(id int, deployed []execute.KindNamespaceName, store execute.Store) error {
+func (m *fakeDoer) Prune(id int, deployed []execute.KindNamespaceName, opt execute.PruneOpt) error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) History(opt execute.PruneOpt) error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) Rollback(id int, revision int, opt execute.PruneOpt) error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) Uninstall(id int, opt execute.PruneOpt) error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) BeginPreflight() {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) EndPreflight() error {
 	panic("implement me") //TODO
 }
 
@@ -262,3 +323,19 @@ func (m fakeVault) Get(key, field string) string {
 	p := path.Join(key, field)
 	return m[p]
 }
+
+func (m *fakeDoer) BeginLint() error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) EndLint() error {
+	panic("implement me") //TODO
+}
+
+func (m *fakeDoer) BeginGenerate() error {
+	return nil
+}
+
+func (m *fakeDoer) EndGenerate() error {
+	return nil
+}
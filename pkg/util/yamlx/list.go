@@ -0,0 +1,119 @@
+package yamlx
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+// ListItems returns the items of a Kubernetes List document (apiVersion v1 with kind List or <Kind>List and an
+// 'items' field).
+// It returns nil when doc isn't a List.
+//
+// The items are sliced from the text of doc so key order, comments and quoting are kept as is.
+// When doc is laid out in a way that doesn't allow that (for example flow style items) the item nodes are encoded
+// instead.
+func ListItems(doc []byte) ([][]byte, error) {
+	root, err := decodeMapping(doc)
+	if err != nil {
+		// not a List
+		return nil, nil
+	}
+
+	_, apiVersion := lookup(root, "apiVersion")
+	if apiVersion == nil || apiVersion.Kind != yaml.ScalarNode || apiVersion.Value != "v1" {
+		return nil, nil
+	}
+	_, kind := lookup(root, "kind")
+	if kind == nil || kind.Kind != yaml.ScalarNode || !strings.HasSuffix(kind.Value, "List") {
+		return nil, nil
+	}
+	_, items := lookup(root, "items")
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+
+	lines := strings.SplitAfter(string(doc), "\n")
+	// end is the line (1 based) after the last line of items.
+	end := len(lines) + 1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if l := root.Content[i].Line; l > items.Line && l < end {
+			end = l
+		}
+	}
+
+	r := make([][]byte, 0, len(items.Content))
+	for i, item := range items.Content {
+		next := end
+		if i+1 < len(items.Content) {
+			next = items.Content[i+1].Line
+		}
+		b, ok := itemText(item, lines, next)
+		if !ok {
+			b, err = encodeNode(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r = append(r, b)
+	}
+
+	return r, nil
+}
+
+// ItemText returns the text of sequence item n, dedented to column 1, by slicing lines up to line next (1 based).
+// It returns false when the text layout doesn't allow slicing.
+func itemText(n *yaml.Node, lines []string, next int) ([]byte, bool) {
+	if n.Kind != yaml.MappingNode || n.Style&yaml.FlowStyle != 0 || next > len(lines)+1 || next <= n.Line {
+		return nil, false
+	}
+	indent := n.Column - 1
+
+	var b strings.Builder
+	for i, l := range lines[n.Line-1 : next-1] {
+		if t := strings.TrimSpace(l); i > 0 && (t == "" || strings.HasPrefix(t, "#")) {
+			// blank lines and comments may have less indentation than the item.
+			if len(l) >= indent && strings.TrimSpace(l[:indent]) == "" {
+				b.WriteString(l[indent:])
+			} else {
+				b.WriteString(strings.TrimLeft(l, " "))
+			}
+			continue
+		}
+		if len(l) < indent {
+			return nil, false
+		}
+		prefix := strings.TrimSpace(l[:indent])
+		if prefix != "" && !(i == 0 && prefix == "-") {
+			// only the first line may have the sequence entry indicator.
+			return nil, false
+		}
+		b.WriteString(l[indent:])
+	}
+	text := strings.TrimRight(b.String(), "\n") + "\n"
+
+	// check that the text decodes to the same item.
+	var want, got interface{}
+	if n.Decode(&want) != nil || yaml.Unmarshal([]byte(text), &got) != nil || !reflect.DeepEqual(want, got) {
+		return nil, false
+	}
+
+	return []byte(text), true
+}
+
+// EncodeNode returns the yaml text of n.
+func encodeNode(n *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(n)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package yamlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestListItems(t *testing.T) {
+	tests := []struct {
+		it   string
+		in   string
+		want []string
+	}{
+		{
+			it: "should_return_nil_for_non_list",
+			in: "kind: ConfigMap\nmetadata:\n  name: cm\n",
+		},
+		{
+			it: "should_return_nil_for_non_yaml",
+			in: "hello world",
+		},
+		{
+			it: "should_return_items_of_list",
+			in: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a # comment
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: 'b'
+`,
+			want: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a # comment\n",
+				"apiVersion: v1\nkind: Secret\nmetadata:\n  name: 'b'\n",
+			},
+		},
+		{
+			it:   "should_return_items_of_typed_list",
+			in:   "apiVersion: v1\nkind: ConfigMapList\nitems:\n- kind: ConfigMap\n",
+			want: []string{"kind: ConfigMap\n"},
+		},
+		{
+			it: "should_return_nil_for_custom_kind_ending_with_list",
+			in: "apiVersion: example.com/v1\nkind: AccessList\nitems:\n- name: a\n",
+		},
+		{
+			it: "should_keep_text_of_indented_items",
+			in: `apiVersion: v1
+kind: List
+items:
+  - kind: ConfigMap
+    data:
+      # comment
+      script: |
+        a
+
+        b
+  -   kind: Secret
+metadata: {}
+`,
+			want: []string{
+				"kind: ConfigMap\ndata:\n  # comment\n  script: |\n    a\n\n    b\n",
+				"kind: Secret\n",
+			},
+		},
+		{
+			it:   "should_encode_flow_style_items",
+			in:   "apiVersion: v1\nkind: List\nitems: [{kind: ConfigMap, metadata: {name: a}}]\n",
+			want: []string{"{kind: ConfigMap, metadata: {name: a}}\n"},
+		},
+		{
+			it:   "should_return_no_items_of_empty_list",
+			in:   "apiVersion: v1\nkind: List\nitems: []\n",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := ListItems([]byte(tt.in))
+			if assert.NoError(t, err) {
+				var gs []string
+				if got != nil {
+					gs = []string{}
+				}
+				for _, g := range got {
+					gs = append(gs, string(g))
+				}
+				assert.Equal(t, tt.want, gs)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package yamlx
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AddMetadata adds labels and annotations to the metadata of the Kubernetes object in doc.
+// Existing keys get the new value.
+//
+// The metadata keys are inserted in the text of doc so key order, comments, quoting and indentation are kept as is.
+// When doc is laid out in a way that doesn't allow that (for example flow style metadata) the yaml node tree is
+// updated and encoded instead.
+func AddMetadata(doc []byte, labels, annotations map[string]string) ([]byte, error) {
+	return AddMetadataAt(doc, nil, labels, annotations)
+}
+
+// AddMetadataAt adds labels and annotations to the metadata of the mapping at path in doc.
+// For example path spec.template selects the pod template of a Deployment.
+// See AddMetadata for details.
+func AddMetadataAt(doc []byte, path []string, labels, annotations map[string]string) ([]byte, error) {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return doc, nil
+	}
+
+	fields := []struct {
+		name string
+		kvs  map[string]string
+	}{
+		{"annotations", annotations},
+		{"labels", labels},
+	}
+
+	// insert text.
+	text := doc
+	ok := true
+	for _, f := range fields {
+		if len(f.kvs) == 0 {
+			continue
+		}
+		root, err := decodeMapping(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range path {
+			_, root = lookup(root, p)
+			if root == nil || root.Kind != yaml.MappingNode {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			break
+		}
+		var lines []string
+		lines, ok = insertMetadata(root, strings.SplitAfter(string(text), "\n"), f.name, f.kvs)
+		if !ok {
+			break
+		}
+		text = []byte(strings.Join(lines, ""))
+	}
+	if ok && sameMetadata(doc, text, path, labels, annotations) {
+		return text, nil
+	}
+
+	var n yaml.Node
+	err := yaml.Unmarshal(doc, &n)
+	if err != nil {
+		return nil, err
+	}
+	root := n.Content[0]
+	for _, p := range path {
+		root = mappingNode(root, p)
+	}
+
+	// update node tree.
+	for _, f := range fields {
+		if len(f.kvs) == 0 {
+			continue
+		}
+		m := mappingNode(mappingNode(root, "metadata"), f.name)
+		for _, k := range sortedKeys(f.kvs) {
+			setScalar(m, k, f.kvs[k])
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&n)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeMapping decodes doc and returns its root mapping node.
+func decodeMapping(doc []byte) (*yaml.Node, error) {
+	var n yaml.Node
+	err := yaml.Unmarshal(doc, &n)
+	if err != nil {
+		return nil, err
+	}
+	if n.Kind != yaml.DocumentNode || len(n.Content) != 1 || n.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a yaml mapping")
+	}
+	return n.Content[0], nil
+}
+
+// InsertMetadata sets kvs in the metadata field of root by editing lines (the text root is decoded from).
+// It returns false when the text layout doesn't allow editing.
+func insertMetadata(root *yaml.Node, lines []string, field string, kvs map[string]string) ([]string, bool) {
+	mk, mv := lookup(root, "metadata")
+	if !isBlockMapping(mk, mv) {
+		return nil, false
+	}
+	indent := mv.Content[0].Column - 1
+	step := indent - (mk.Column - 1)
+
+	fk, fv := lookup(mv, field)
+	if fk == nil {
+		// insert field as first key of metadata.
+		ins := []string{strings.Repeat(" ", indent) + field + ":\n"}
+		for _, k := range sortedKeys(kvs) {
+			ins = append(ins, strings.Repeat(" ", indent+step)+scalar(k, 0)+": "+scalar(kvs[k], 0)+"\n")
+		}
+		return insertLines(lines, mk.Line, ins), true
+	}
+	if !isBlockMapping(fk, fv) {
+		return nil, false
+	}
+	indent = fv.Content[0].Column - 1
+
+	var ins []string
+	for _, k := range sortedKeys(kvs) {
+		v := kvs[k]
+		vk, vv := lookup(fv, k)
+		if vk == nil {
+			ins = append(ins, strings.Repeat(" ", indent)+scalar(k, 0)+": "+scalar(v, 0)+"\n")
+			continue
+		}
+		if vv.Kind == yaml.ScalarNode && vv.Value == v {
+			continue
+		}
+		if vv.Kind != yaml.ScalarNode || vv.Line != vk.Line || vv.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			return nil, false
+		}
+		// replace value.
+		l := []rune(lines[vv.Line-1])
+		if vv.Column-1 > len(l) {
+			return nil, false
+		}
+		s := string(l[:vv.Column-1]) + scalar(v, vv.Style)
+		if vv.LineComment != "" {
+			s += " " + vv.LineComment
+		}
+		if strings.HasSuffix(lines[vv.Line-1], "\n") {
+			s += "\n"
+		}
+		lines[vv.Line-1] = s
+	}
+
+	return insertLines(lines, fk.Line, ins), true
+}
+
+// IsBlockMapping returns true when value v of key k is a non-empty block style mapping that starts on a next line.
+func isBlockMapping(k, v *yaml.Node) bool {
+	return k != nil && v.Kind == yaml.MappingNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 &&
+		v.Content[0].Line > k.Line
+}
+
+// InsertLines returns lines with ins inserted after line n (1 based).
+func insertLines(lines []string, n int, ins []string) []string {
+	if len(ins) == 0 {
+		return lines
+	}
+	r := make([]string, 0, len(lines)+len(ins))
+	r = append(r, lines[:n]...)
+	r = append(r, ins...)
+	return append(r, lines[n:]...)
+}
+
+// SameMetadata returns true when doc b equals doc a with labels and annotations added to the metadata at path.
+func sameMetadata(a, b []byte, path []string, labels, annotations map[string]string) bool {
+	var want, got map[string]interface{}
+	if yaml.Unmarshal(a, &want) != nil || yaml.Unmarshal(b, &got) != nil {
+		return false
+	}
+
+	m := want
+	for _, p := range append(append([]string{}, path...), "metadata") {
+		v, ok := m[p].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		m = v
+	}
+	meta := m
+	for f, kvs := range map[string]map[string]string{"labels": labels, "annotations": annotations} {
+		if len(kvs) == 0 {
+			continue
+		}
+		m, ok := meta[f].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			meta[f] = m
+		}
+		for k, v := range kvs {
+			m[k] = v
+		}
+	}
+
+	return reflect.DeepEqual(want, got)
+}
+
+// Lookup returns the key and value nodes of key in mapping m or nil when not found.
+func lookup(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// MappingNode returns the mapping value of key in mapping m, the value is created when it's absent or not a mapping.
+func mappingNode(m *yaml.Node, key string) *yaml.Node {
+	_, v := lookup(m, key)
+	if v == nil {
+		v = &yaml.Node{}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+	if v.Kind != yaml.MappingNode {
+		*v = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return v
+}
+
+// SetScalar sets key to string value in mapping m.
+func setScalar(m *yaml.Node, key, value string) {
+	_, v := lookup(m, key)
+	if v == nil {
+		v = &yaml.Node{}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+	style := v.Style & (yaml.SingleQuotedStyle | yaml.DoubleQuotedStyle)
+	if strings.Contains(value, "\n") {
+		style = yaml.DoubleQuotedStyle
+	}
+	*v = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+// Scalar returns the yaml text of string s in a single line.
+// Style selects single or double quotes, s is quoted anyway when it would otherwise not be read back as the same string.
+func scalar(s string, style yaml.Style) string {
+	style &= yaml.SingleQuotedStyle | yaml.DoubleQuotedStyle
+	if strings.Contains(s, "\n") {
+		style = yaml.DoubleQuotedStyle
+	}
+	b, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: style})
+	if err != nil {
+		// should not happen, fallback to double quotes.
+		b, _ = yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: yaml.DoubleQuotedStyle})
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
+
+// SortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,92 @@
+package yamlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAddMetadata(t *testing.T) {
+	tests := []struct {
+		it          string
+		in          string
+		labels      map[string]string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			it: "should_keep_order_comments_quotes_and_indentation",
+			in: `# comment
+kind: Deployment
+metadata:
+  name: 'app' # trailing comment
+spec:
+  containers:
+  - name: c
+    args: ["--x", '--y']
+`,
+			labels:      map[string]string{"b": "true", "a": "x"},
+			annotations: map[string]string{"note": "it's: here"},
+			want: `# comment
+kind: Deployment
+metadata:
+  labels:
+    a: x
+    b: "true"
+  annotations:
+    note: 'it''s: here'
+  name: 'app' # trailing comment
+spec:
+  containers:
+  - name: c
+    args: ["--x", '--y']
+`,
+		},
+		{
+			it: "should_add_to_and_update_existing_labels",
+			in: `kind: ConfigMap
+metadata:
+    name: cm
+    labels:
+        # comment
+        a: 'old' # trailing comment
+        c: keep
+`,
+			labels: map[string]string{"a": "new", "b": "x"},
+			want: `kind: ConfigMap
+metadata:
+    name: cm
+    labels:
+        b: x
+        # comment
+        a: 'new' # trailing comment
+        c: keep
+`,
+		},
+		{
+			it:     "should_not_change_existing_label_with_same_value",
+			in:     "kind: ConfigMap\nmetadata:\n  labels:\n    a: \"x\"\n  name: cm",
+			labels: map[string]string{"a": "x"},
+			want:   "kind: ConfigMap\nmetadata:\n  labels:\n    a: \"x\"\n  name: cm",
+		},
+		{
+			it:     "should_encode_node_tree_when_metadata_is_flow_style",
+			in:     "kind: ConfigMap\nmetadata: {name: cm}\n",
+			labels: map[string]string{"a": "x"},
+			want:   "kind: ConfigMap\nmetadata: {name: cm, labels: {a: x}}\n",
+		},
+		{
+			it:     "should_encode_node_tree_when_metadata_is_absent",
+			in:     "kind: ConfigMap\ndata:\n  k: v\n",
+			labels: map[string]string{"a": "x"},
+			want:   "kind: ConfigMap\ndata:\n  k: v\nmetadata:\n  labels:\n    a: x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := AddMetadata([]byte(tt.in), tt.labels, tt.annotations)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}
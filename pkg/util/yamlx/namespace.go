@@ -0,0 +1,144 @@
+package yamlx
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+// SetNamespace sets metadata.namespace of the Kubernetes object in doc when it's absent or empty.
+// Like AddMetadata the text of doc is edited so formatting is kept.
+func SetNamespace(doc []byte, namespace string) ([]byte, error) {
+	return setKey(doc, "namespace", namespace, func(root *yaml.Node) []*yaml.Node {
+		return []*yaml.Node{mappingNode(root, "metadata")}
+	})
+}
+
+// SetSubjectNamespaces sets the namespace of the ServiceAccount subjects of the (Cluster)RoleBinding in doc that
+// don't have a namespace.
+func SetSubjectNamespaces(doc []byte, namespace string) ([]byte, error) {
+	return setKey(doc, "namespace", namespace, func(root *yaml.Node) []*yaml.Node {
+		_, subjects := lookup(root, "subjects")
+		if subjects == nil || subjects.Kind != yaml.SequenceNode {
+			return nil
+		}
+		var r []*yaml.Node
+		for _, s := range subjects.Content {
+			if _, k := lookup(s, "kind"); s.Kind == yaml.MappingNode && k != nil && k.Value == "ServiceAccount" {
+				r = append(r, s)
+			}
+		}
+		return r
+	})
+}
+
+// SetKey sets key to value in the mappings returned by targets when key is absent or empty.
+// Key is inserted in the text of doc after the first key of a mapping, when the layout doesn't allow that the yaml
+// node tree is updated and encoded instead.
+func setKey(doc []byte, key, value string, targets func(root *yaml.Node) []*yaml.Node) ([]byte, error) {
+	root, err := decodeMapping(doc)
+	if err != nil {
+		return nil, err
+	}
+	var ms []*yaml.Node
+	for _, m := range targets(root) {
+		if _, v := lookup(m, key); v == nil || (v.Kind == yaml.ScalarNode && v.Value == "") {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) == 0 {
+		return doc, nil
+	}
+
+	// insert text, last lines first so line numbers of the other mappings stay valid.
+	lines := strings.SplitAfter(string(doc), "\n")
+	ok := true
+	for i := len(ms) - 1; i >= 0 && ok; i-- {
+		lines, ok = insertKey(ms[i], lines, key, value)
+	}
+	if ok {
+		text := []byte(strings.Join(lines, ""))
+		if sameKeys(doc, text, targets, key, value) {
+			return text, nil
+		}
+	}
+
+	// update node tree.
+	for _, m := range ms {
+		setScalar(m, key, value)
+	}
+	var n yaml.Node
+	n.Kind = yaml.DocumentNode
+	n.Content = []*yaml.Node{root}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&n)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// InsertKey sets key to value in mapping m by editing lines (the text m is decoded from).
+// It returns false when the text layout doesn't allow editing.
+func insertKey(m *yaml.Node, lines []string, key, value string) ([]string, bool) {
+	if m.Kind != yaml.MappingNode || m.Style&yaml.FlowStyle != 0 || len(m.Content) < 2 {
+		return nil, false
+	}
+	if k, v := lookup(m, key); k != nil {
+		// replace empty value.
+		if v.Line != k.Line || v.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || k.Line > len(lines) {
+			return nil, false
+		}
+		l := []rune(lines[k.Line-1])
+		if k.Column-1 > len(l) {
+			return nil, false
+		}
+		s := string(l[:k.Column-1]) + scalar(key, 0) + ": " + scalar(value, v.Style)
+		if v.LineComment != "" {
+			s += " " + v.LineComment
+		}
+		if strings.HasSuffix(lines[k.Line-1], "\n") {
+			s += "\n"
+		}
+		lines[k.Line-1] = s
+		return lines, true
+	}
+
+	// insert key after the first key of m (its value must be on the same line).
+	fk, fv := m.Content[0], m.Content[1]
+	if fv.Kind != yaml.ScalarNode || fv.Line != fk.Line || fv.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return nil, false
+	}
+	ins := strings.Repeat(" ", fk.Column-1) + scalar(key, 0) + ": " + scalar(value, 0) + "\n"
+	if !strings.HasSuffix(lines[fk.Line-1], "\n") {
+		// last line, keep doc without trailing newline.
+		lines[fk.Line-1] += "\n"
+		ins = strings.TrimSuffix(ins, "\n")
+	}
+	return insertLines(lines, fk.Line, []string{ins}), true
+}
+
+// SameKeys returns true when doc b equals doc a with key set to value in the mappings returned by targets.
+func sameKeys(a, b []byte, targets func(root *yaml.Node) []*yaml.Node, key, value string) bool {
+	ra, err := decodeMapping(a)
+	if err != nil {
+		return false
+	}
+	for _, m := range targets(ra) {
+		if _, v := lookup(m, key); v == nil || (v.Kind == yaml.ScalarNode && v.Value == "") {
+			setScalar(m, key, value)
+		}
+	}
+	var want, got interface{}
+	if ra.Decode(&want) != nil || yaml.Unmarshal(b, &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
@@ -0,0 +1,96 @@
+package yamlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSetNamespace(t *testing.T) {
+	tests := []struct {
+		it   string
+		in   string
+		want string
+	}{
+		{
+			it: "should_insert_namespace_after_first_metadata_key",
+			in: `kind: ConfigMap
+metadata:
+    name: cm # comment
+    labels:
+        a: x
+`,
+			want: `kind: ConfigMap
+metadata:
+    name: cm # comment
+    namespace: ns
+    labels:
+        a: x
+`,
+		},
+		{
+			it:   "should_set_empty_namespace",
+			in:   "kind: ConfigMap\nmetadata:\n  name: cm\n  namespace: \"\"\n",
+			want: "kind: ConfigMap\nmetadata:\n  name: cm\n  namespace: \"ns\"\n",
+		},
+		{
+			it:   "should_keep_existing_namespace",
+			in:   "kind: ConfigMap\nmetadata:\n  name: cm\n  namespace: other\n",
+			want: "kind: ConfigMap\nmetadata:\n  name: cm\n  namespace: other\n",
+		},
+		{
+			it:   "should_keep_doc_without_trailing_newline",
+			in:   "kind: ConfigMap\nmetadata:\n  name: cm",
+			want: "kind: ConfigMap\nmetadata:\n  name: cm\n  namespace: ns",
+		},
+		{
+			it:   "should_encode_node_tree_when_metadata_is_flow_style",
+			in:   "kind: ConfigMap\nmetadata: {name: cm}\n",
+			want: "kind: ConfigMap\nmetadata: {name: cm, namespace: ns}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := SetNamespace([]byte(tt.in), "ns")
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestSetSubjectNamespaces(t *testing.T) {
+	in := `kind: RoleBinding
+metadata:
+  name: rb
+subjects:
+- kind: ServiceAccount
+  name: a
+- kind: ServiceAccount
+  name: b
+  namespace: other
+- kind: User
+  name: c
+- kind: ServiceAccount
+  name: d
+`
+	want := `kind: RoleBinding
+metadata:
+  name: rb
+subjects:
+- kind: ServiceAccount
+  namespace: ns
+  name: a
+- kind: ServiceAccount
+  name: b
+  namespace: other
+- kind: User
+  name: c
+- kind: ServiceAccount
+  namespace: ns
+  name: d
+`
+	got, err := SetSubjectNamespaces([]byte(in), "ns")
+	if assert.NoError(t, err) {
+		assert.Equal(t, want, string(got))
+	}
+}
@@ -0,0 +1,131 @@
+package yamlx
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+// ReplaceScalars replaces the string values at paths in doc by the result of fn.
+// A path element [] selects all items of a sequence, for example spec.containers.[].image.
+//
+// Like AddMetadata the text of doc is edited so formatting is kept, when the layout doesn't allow that the yaml node
+// tree is updated and encoded instead.
+func ReplaceScalars(doc []byte, paths [][]string, fn func(string) string) ([]byte, error) {
+	root, err := decodeMapping(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		node  *yaml.Node
+		value string
+	}
+	var changes []change
+	for _, p := range paths {
+		for _, n := range nodesAt(root, p) {
+			if n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+				continue
+			}
+			if v := fn(n.Value); v != n.Value {
+				changes = append(changes, change{node: n, value: v})
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return doc, nil
+	}
+
+	// replace text.
+	lines := strings.SplitAfter(string(doc), "\n")
+	ok := true
+	for _, c := range changes {
+		if !replaceScalar(lines, c.node, c.value) {
+			ok = false
+			break
+		}
+	}
+	if ok {
+		text := []byte(strings.Join(lines, ""))
+		got, err := decodeMapping(text)
+		if err == nil {
+			for _, c := range changes {
+				c.node.Value = c.value
+			}
+			var a, b interface{}
+			if root.Decode(&a) == nil && got.Decode(&b) == nil && reflect.DeepEqual(a, b) {
+				return text, nil
+			}
+		}
+	}
+
+	// update node tree.
+	for _, c := range changes {
+		style := c.node.Style & (yaml.SingleQuotedStyle | yaml.DoubleQuotedStyle)
+		*c.node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: c.value, Style: style,
+			LineComment: c.node.LineComment, HeadComment: c.node.HeadComment, FootComment: c.node.FootComment}
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NodesAt returns the nodes at path in n.
+func nodesAt(n *yaml.Node, path []string) []*yaml.Node {
+	if len(path) == 0 {
+		return []*yaml.Node{n}
+	}
+	switch {
+	case path[0] == "[]" && n.Kind == yaml.SequenceNode:
+		var r []*yaml.Node
+		for _, c := range n.Content {
+			r = append(r, nodesAt(c, path[1:])...)
+		}
+		return r
+	case n.Kind == yaml.MappingNode:
+		if _, v := lookup(n, path[0]); v != nil {
+			return nodesAt(v, path[1:])
+		}
+	}
+	return nil
+}
+
+// ReplaceScalar replaces the single line scalar n in lines by value.
+// It returns false when n isn't the last value on its line (ignoring a comment).
+func replaceScalar(lines []string, n *yaml.Node, value string) bool {
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || n.Line > len(lines) {
+		return false
+	}
+	line := lines[n.Line-1]
+	l := []rune(strings.TrimSuffix(line, "\n"))
+	if n.Column-1 > len(l) {
+		return false
+	}
+
+	// the rest of the line must be the scalar (and comment).
+	rest := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(string(l[n.Column-1:])), n.LineComment))
+	var v string
+	if yaml.Unmarshal([]byte(rest), &v) != nil || v != n.Value {
+		return false
+	}
+
+	s := string(l[:n.Column-1]) + scalar(value, n.Style)
+	if n.LineComment != "" {
+		s += " " + n.LineComment
+	}
+	if strings.HasSuffix(line, "\n") {
+		s += "\n"
+	}
+	lines[n.Line-1] = s
+	return true
+}
@@ -0,0 +1,64 @@
+package yamlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestReplaceScalars(t *testing.T) {
+	tests := []struct {
+		it   string
+		in   string
+		want string
+	}{
+		{
+			it: "should_keep_formatting",
+			in: `spec:
+  containers:
+  - name: a
+    image: "nginx:1.19" # comment
+  - name: b
+    image: redis
+  initContainers:
+  - image: busybox
+`,
+			want: `spec:
+  containers:
+  - name: a
+    image: "new-nginx:1.19" # comment
+  - name: b
+    image: new-redis
+  initContainers:
+  - image: new-busybox
+`,
+		},
+		{
+			it:   "should_encode_node_tree_for_flow_style",
+			in:   "spec:\n  containers: [{name: a, image: nginx}]\n",
+			want: "spec:\n  containers: [{name: a, image: new-nginx}]\n",
+		},
+		{
+			it:   "should_return_doc_when_unchanged",
+			in:   "spec:\n  other: x\n",
+			want: "spec:\n  other: x\n",
+		},
+	}
+	paths := [][]string{
+		{"spec", "containers", "[]", "image"},
+		{"spec", "initContainers", "[]", "image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := ReplaceScalars([]byte(tt.in), paths, func(s string) string {
+				if strings.HasPrefix(s, "new-") {
+					return s
+				}
+				return "new-" + s
+			})
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}